@@ -7,9 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"regexp"
+	"time"
 
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/id"
 	"maunium.net/go/mautrix/synapseadmin"
@@ -31,10 +36,11 @@ func IsValidBotUsername(username string) bool {
 
 func IsUsernameAvailable(ctx context.Context, username string) (bool, error) {
 	if cfg.BeeperAPIURL != "" {
-		resp, err := cli.Client.Get(cfg.BeeperAPIURL + "/check-username/" + url.PathEscape(username))
+		resp, err := beeperAPIRequest(ctx, http.MethodGet, "/check-username/"+url.PathEscape(username), nil)
 		if err != nil {
 			return false, fmt.Errorf("failed to send request to api server: %w", err)
 		}
+		defer resp.Body.Close()
 		var respData BeeperCheckUsernameResponse
 		err = json.NewDecoder(resp.Body).Decode(&respData)
 		if err != nil {
@@ -58,7 +64,27 @@ func IsUsernameAvailable(ctx context.Context, username string) (bool, error) {
 	}
 }
 
+// Login records the new device as a known device, so that it isn't reported as unknown by reconcile.
 func Login(ctx context.Context, userID id.UserID, password string) (*mautrix.RespLogin, error) {
+	start := time.Now()
+	resp, err := login(userID, password)
+	observeAccountOperation("login", start, err)
+	if err != nil {
+		return nil, err
+	}
+	err = db.AddBotDevice(ctx, &BotDevice{
+		BotMXID:         resp.UserID,
+		DeviceID:        resp.DeviceID,
+		CreatedByBotbot: true,
+		FirstSeen:       time.Now(),
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to store new bot device in database")
+	}
+	return resp, nil
+}
+
+func login(userID id.UserID, password string) (*mautrix.RespLogin, error) {
 	loginClient, _ := mautrix.NewClient(cfg.HomeserverURL, "", "")
 	identifier := mautrix.UserIdentifier{
 		Type: mautrix.IdentifierTypeUser,
@@ -84,15 +110,200 @@ func Login(ctx context.Context, userID id.UserID, password string) (*mautrix.Res
 	}
 }
 
+// If JWT login isn't configured, LoginNewDevice resets the password first, without logging out existing devices.
+func LoginNewDevice(ctx context.Context, userID id.UserID) (*mautrix.RespLogin, error) {
+	if cfg.LoginJWTKey != "" {
+		return Login(ctx, userID, "")
+	}
+	password := util.RandomString(72)
+	err := synadm.ResetPassword(ctx, synapseadmin.ReqResetPassword{
+		UserID:        userID,
+		NewPassword:   password,
+		LogoutDevices: false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset password: %w", err)
+	}
+	return Login(ctx, userID, password)
+}
+
+func DeleteDevice(ctx context.Context, userID id.UserID, deviceID id.DeviceID) error {
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:  http.MethodDelete,
+		URL:     synadm.BuildAdminURL("v2", "users", userID, "devices", deviceID),
+		Context: ctx,
+	})
+	return err
+}
+
+type reqDeleteDevices struct {
+	Devices []id.DeviceID `json:"devices"`
+}
+
+func DeleteDevices(ctx context.Context, userID id.UserID, deviceIDs []id.DeviceID) error {
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:      http.MethodPost,
+		URL:         synadm.BuildAdminURL("v2", "users", userID, "delete_devices"),
+		RequestJSON: &reqDeleteDevices{Devices: deviceIDs},
+		Context:     ctx,
+	})
+	return err
+}
+
+type reqSetLocked struct {
+	Locked bool `json:"locked"`
+}
+
+// Locked users can't log in, and all requests made with their existing access tokens are rejected.
+func SetUserLocked(ctx context.Context, userID id.UserID, locked bool) error {
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:      http.MethodPut,
+		URL:         synadm.BuildAdminURL("v2", "users", userID),
+		RequestJSON: &reqSetLocked{Locked: locked},
+		Context:     ctx,
+	})
+	return err
+}
+
+type RatelimitOverride struct {
+	MessagesPerSecond int `json:"messages_per_second"`
+	BurstCount        int `json:"burst_count"`
+}
+
+func GetRatelimitOverride(ctx context.Context, userID id.UserID) (*RatelimitOverride, error) {
+	var resp struct {
+		MessagesPerSecond *int `json:"messages_per_second"`
+		BurstCount        *int `json:"burst_count"`
+	}
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:       http.MethodGet,
+		URL:          synadm.BuildAdminURL("v1", "users", userID, "override_ratelimit"),
+		ResponseJSON: &resp,
+		Context:      ctx,
+	})
+	if err != nil || resp.MessagesPerSecond == nil || resp.BurstCount == nil {
+		return nil, err
+	}
+	return &RatelimitOverride{MessagesPerSecond: *resp.MessagesPerSecond, BurstCount: *resp.BurstCount}, nil
+}
+
+func SetRatelimitOverride(ctx context.Context, userID id.UserID, override *RatelimitOverride) error {
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:      http.MethodPost,
+		URL:         synadm.BuildAdminURL("v1", "users", userID, "override_ratelimit"),
+		RequestJSON: override,
+		Context:     ctx,
+	})
+	return err
+}
+
+func DeleteRatelimitOverride(ctx context.Context, userID id.UserID) error {
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:  http.MethodDelete,
+		URL:     synadm.BuildAdminURL("v1", "users", userID, "override_ratelimit"),
+		Context: ctx,
+	})
+	return err
+}
+
+type respJoinedRooms struct {
+	JoinedRooms []id.RoomID `json:"joined_rooms"`
+	Total       int         `json:"total"`
+}
+
+func GetJoinedRooms(ctx context.Context, userID id.UserID) ([]id.RoomID, error) {
+	var resp respJoinedRooms
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:       http.MethodGet,
+		URL:          synadm.BuildAdminURL("v1", "users", userID, "joined_rooms"),
+		ResponseJSON: &resp,
+		Context:      ctx,
+	})
+	return resp.JoinedRooms, err
+}
+
+type RoomInfo struct {
+	RoomID         id.RoomID    `json:"room_id"`
+	Name           string       `json:"name"`
+	CanonicalAlias id.RoomAlias `json:"canonical_alias"`
+	JoinedMembers  int          `json:"joined_members"`
+}
+
+func GetRoomInfo(ctx context.Context, roomID id.RoomID) (*RoomInfo, error) {
+	var resp RoomInfo
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:       http.MethodGet,
+		URL:          synadm.BuildAdminURL("v1", "rooms", roomID),
+		ResponseJSON: &resp,
+		Context:      ctx,
+	})
+	return &resp, err
+}
+
+type reqLoginAsUser struct {
+	ValidUntilMS int64 `json:"valid_until_ms"`
+}
+
+type respLoginAsUser struct {
+	AccessToken string `json:"access_token"`
+}
+
+// Tokens from WithTemporarySession expire by themselves in case logging out fails.
+const temporarySessionLifetime = 5 * time.Minute
+
+// The session doesn't have a device and is logged out after fn returns.
+func WithTemporarySession(ctx context.Context, userID id.UserID, fn func(client *mautrix.Client) error) error {
+	var resp respLoginAsUser
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:       http.MethodPost,
+		URL:          synadm.BuildAdminURL("v1", "users", userID, "login"),
+		RequestJSON:  &reqLoginAsUser{ValidUntilMS: time.Now().Add(temporarySessionLifetime).UnixMilli()},
+		ResponseJSON: &resp,
+		Context:      ctx,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to log in as user: %w", err)
+	}
+	client, err := mautrix.NewClient(cfg.HomeserverURL, userID, resp.AccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer func() {
+		_, logoutErr := client.Logout()
+		if logoutErr != nil {
+			zerolog.Ctx(ctx).Warn().Err(logoutErr).Msg("Failed to log out temporary session")
+		}
+	}()
+	return fn(client)
+}
+
+type reqDeactivate struct {
+	Erase bool `json:"erase"`
+}
+
+func DeactivateUser(ctx context.Context, userID id.UserID) error {
+	_, err := synadm.MakeFullRequest(mautrix.FullRequest{
+		Method:      http.MethodPost,
+		URL:         synadm.BuildAdminURL("v1", "deactivate", userID),
+		RequestJSON: &reqDeactivate{Erase: false},
+		Context:     ctx,
+	})
+	return err
+}
+
 func RegisterUser(ctx context.Context, username string) (string, error) {
 	password := util.RandomString(72)
+	start := time.Now()
+	var err error
 	if cfg.BeeperAPIURL != "" {
-		return password, registerUserBeeper(ctx, username, password)
+		err = registerUserBeeper(ctx, username, password)
 	} else if cfg.RegisterSecret != "" {
-		return password, registerUserSynapse(ctx, username, password)
+		err = registerUserSynapse(ctx, username, password)
 	} else {
 		return "", fmt.Errorf("no way to register users configured")
 	}
+	observeAccountOperation("register", start, err)
+	return password, err
 }
 
 func registerUserSynapse(ctx context.Context, username, password string) error {
@@ -106,6 +317,29 @@ func registerUserSynapse(ctx context.Context, username, password string) error {
 	return err
 }
 
+func beeperAPIRequest(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	ctx, span := tracer.Start(ctx, "beeper api request", trace.WithAttributes(
+		attribute.String("http.method", method),
+		attribute.String("http.target", path),
+	))
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, method, cfg.BeeperAPIURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	addRequestHeaders(ctx, req)
+	resp, err := cli.Client.Do(req)
+	if err != nil {
+		setSpanError(ctx, err, "request failed")
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	return resp, nil
+}
+
 type reqBeeperRegister struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -120,10 +354,11 @@ func registerUserBeeper(ctx context.Context, username, password string) error {
 	if err != nil {
 		return fmt.Errorf("failed to encode request body: %w", err)
 	}
-	resp, err := cli.Client.Post(cfg.BeeperAPIURL+"/admin/bot/"+url.PathEscape(username), "application/json", &body)
+	resp, err := beeperAPIRequest(ctx, http.MethodPost, "/admin/bot/"+url.PathEscape(username), &body)
 	if err != nil {
 		return fmt.Errorf("failed to send request to api server: %w", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == 200 || resp.StatusCode == 201 {
 		return nil
 	}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+type AuditAction string
+
+const (
+	AuditBotCreated       AuditAction = "bot_created"
+	AuditCreateRequested  AuditAction = "create_requested"
+	AuditCreateApproved   AuditAction = "create_approved"
+	AuditCreateDenied     AuditAction = "create_denied"
+	AuditBotReset         AuditAction = "bot_reset"
+	AuditBotTransferred   AuditAction = "bot_transferred"
+	AuditBotShared        AuditAction = "bot_shared"
+	AuditBotUnshared      AuditAction = "bot_unshared"
+	AuditBotSuspended     AuditAction = "bot_suspended"
+	AuditBotResumed       AuditAction = "bot_resumed"
+	AuditBotDeactivated   AuditAction = "bot_deactivated"
+	AuditBotExtended      AuditAction = "bot_extended"
+	AuditBotKicked        AuditAction = "bot_kicked"
+	AuditTokenCreated     AuditAction = "token_created"
+	AuditDeviceRevoked    AuditAction = "device_revoked"
+	AuditUnknownDevice    AuditAction = "unknown_device"
+	AuditRatelimitAsked   AuditAction = "ratelimit_requested"
+	AuditRatelimitChanged AuditAction = "ratelimit_changed"
+	AuditUntrustedDevice  AuditAction = "untrusted_device"
+	AuditInviteRejected   AuditAction = "invite_rejected"
+	AuditJobFailed        AuditAction = "job_failed"
+)
+
+// AuditEventContentKey is the key in audit notices that contains the AuditEntry, so that tools can parse them.
+const AuditEventContentKey = "com.beeper.botbot.audit"
+
+type AuditEntry struct {
+	ID        int64       `json:"id,omitempty"`
+	Action    AuditAction `json:"action"`
+	Actor     id.UserID   `json:"actor"`
+	Bot       id.UserID   `json:"bot,omitempty"`
+	RoomID    id.RoomID   `json:"room_id,omitempty"`
+	Details   string      `json:"details,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Timestamp int64       `json:"timestamp"`
+}
+
+func (entry *AuditEntry) String() string {
+	var buf strings.Builder
+	_, _ = fmt.Fprintf(&buf, "**%s** by %s", entry.Action, entry.Actor)
+	if entry.Bot != "" {
+		_, _ = fmt.Fprintf(&buf, " for ´%s´", entry.Bot)
+	}
+	if entry.RoomID != "" {
+		_, _ = fmt.Fprintf(&buf, " in ´%s´", entry.RoomID)
+	}
+	if entry.Details != "" {
+		_, _ = fmt.Fprintf(&buf, ": %s", entry.Details)
+	}
+	if entry.Error != "" {
+		_, _ = fmt.Fprintf(&buf, " (failed: %s)", entry.Error)
+	}
+	return buf.String()
+}
+
+// commandAudit tracks what the current command is doing, so that failures can be recorded in replyErr.
+type commandAudit struct {
+	Action   AuditAction
+	Bot      id.UserID
+	Recorded bool
+	// Failed is set when the command replies with an internal error, even if it didn't change anything.
+	Failed bool
+}
+
+func getCommandAudit(ctx context.Context) *commandAudit {
+	cmdAudit, _ := ctx.Value(contextKeyCommandAudit).(*commandAudit)
+	return cmdAudit
+}
+
+// setAuditTarget marks the current command as state-changing. If the command fails with replyErr
+// before it records a successful result with auditCommand, the failure is recorded in the audit log.
+func setAuditTarget(ctx context.Context, action AuditAction, bot id.UserID) {
+	if cmdAudit := getCommandAudit(ctx); cmdAudit != nil {
+		cmdAudit.Action = action
+		cmdAudit.Bot = bot
+	}
+}
+
+func getActor(ctx context.Context) id.UserID {
+	if evt, ok := ctx.Value(contextKeyEvent).(*event.Event); ok {
+		return evt.Sender
+	}
+	userID, _ := ctx.Value(contextKeyAPIUser).(id.UserID)
+	return userID
+}
+
+func auditCommand(ctx context.Context, action AuditAction, bot id.UserID, details string, args ...any) {
+	if cmdAudit := getCommandAudit(ctx); cmdAudit != nil {
+		cmdAudit.Recorded = true
+	}
+	audit(ctx, &AuditEntry{Action: action, Actor: getActor(ctx), Bot: bot, Details: formatDetails(details, args)})
+}
+
+func auditCommandFailure(ctx context.Context, err error, message string) {
+	cmdAudit := getCommandAudit(ctx)
+	if cmdAudit == nil {
+		return
+	}
+	cmdAudit.Failed = true
+	if cmdAudit.Action == "" || cmdAudit.Recorded {
+		return
+	}
+	cmdAudit.Recorded = true
+	audit(ctx, &AuditEntry{
+		Action:  cmdAudit.Action,
+		Actor:   getActor(ctx),
+		Bot:     cmdAudit.Bot,
+		Details: message,
+		Error:   err.Error(),
+	})
+}
+
+func auditSystem(ctx context.Context, action AuditAction, bot id.UserID, details string, args ...any) {
+	audit(ctx, &AuditEntry{Action: action, Actor: cli.UserID, Bot: bot, Details: formatDetails(details, args)})
+}
+
+func formatDetails(details string, args []any) string {
+	if len(args) > 0 {
+		return fmt.Sprintf(details, args...)
+	}
+	return details
+}
+
+// Notices in the admin room may contain sensitive details, so they're only posted if it's encrypted.
+func canPostInAdminRoom(ctx context.Context) bool {
+	if !cli.StateStore.IsEncrypted(cfg.AdminRoom) {
+		zerolog.Ctx(ctx).Error().Msg("Admin room is not encrypted, not posting notice in it")
+		return false
+	}
+	return true
+}
+
+func audit(ctx context.Context, entry *AuditEntry) {
+	if entry.Timestamp == 0 {
+		entry.Timestamp = time.Now().UnixMilli()
+	}
+	log := zerolog.Ctx(ctx)
+	if err := db.InsertAuditLog(ctx, entry); err != nil {
+		log.Err(err).Msg("Failed to store audit log entry")
+	}
+	log.Info().
+		Str("audit_action", string(entry.Action)).
+		Str("audit_actor", entry.Actor.String()).
+		Str("audit_bot", entry.Bot.String()).
+		Str("audit_room_id", entry.RoomID.String()).
+		Str("audit_details", entry.Details).
+		Str("audit_error", entry.Error).
+		Msg("Audit event")
+	if cfg.AdminRoom == "" || !canPostInAdminRoom(ctx) {
+		return
+	}
+	_, err := cli.SendMessageEvent(cfg.AdminRoom, event.EventMessage, &event.Content{
+		Parsed: renderNotice(entry.String()),
+		Raw:    map[string]any{AuditEventContentKey: entry},
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to send audit notice to admin room")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/id"
+)
+
+type AccountDataDefaults map[string]json.RawMessage
+
+func (add *AccountDataDefaults) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*map[string]json.RawMessage)(add))
+}
+
+type reqPushRuleEnabled struct {
+	Enabled bool `json:"enabled"`
+}
+
+// There's no Synapse API for hiding individual users from the user directory, so that's left to
+// the user_directory settings of the homeserver.
+func applyBotDefaults(ctx context.Context, userID id.UserID) error {
+	return WithTemporarySession(ctx, userID, func(client *mautrix.Client) error {
+		log := zerolog.Ctx(ctx)
+		var errs []error
+		if cfg.BotDisablePushRules {
+			// The master rule suppresses all notifications when it's enabled
+			url := client.BuildClientURL("v3", "pushrules", "global", "override", ".m.rule.master", "enabled")
+			_, err := client.MakeRequest(http.MethodPut, url, &reqPushRuleEnabled{Enabled: true}, nil)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to disable push rules: %w", err))
+			} else {
+				log.Debug().Msg("Disabled push rules of new bot")
+			}
+		}
+		if cfg.BotPresence != "none" {
+			err := client.SetPresence(cfg.BotPresence)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to set presence: %w", err))
+			} else {
+				log.Debug().Str("presence", string(cfg.BotPresence)).Msg("Set presence of new bot")
+			}
+		}
+		for eventType, content := range cfg.BotAccountData {
+			err := client.SetAccountData(eventType, content)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to set %s account data: %w", eventType, err))
+			} else {
+				log.Debug().Str("account_data_type", eventType).Msg("Set account data of new bot")
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/util"
+)
+
+const botExpiryWarningBefore = 24 * time.Hour
+
+const botExpiryWarning = "Your bot ´%s´ will be deactivated in %s. Use ´extend %s <duration>´ to keep it around for longer."
+const botExpired = "Your bot ´%s´ has expired and was deactivated."
+
+type BotExpiryPayload struct {
+	BotMXID id.UserID `json:"bot_mxid"`
+	// RoomID is where notifications are sent. If it's empty, the owner's management room is used.
+	RoomID id.RoomID `json:"room_id,omitempty"`
+}
+
+func botExpiryJobKey(action JobAction, userID id.UserID) string {
+	return fmt.Sprintf("%s:%s", action, userID)
+}
+
+// The owner is warned a day before the bot expires.
+func scheduleBotExpiry(ctx context.Context, userID id.UserID, roomID id.RoomID, expiresAt time.Time) error {
+	payload := &BotExpiryPayload{
+		BotMXID: userID,
+		RoomID:  roomID,
+	}
+	warnAt := expiresAt.Add(-botExpiryWarningBefore)
+	warningKey := botExpiryJobKey(JobActionBotExpiryWarning, userID)
+	var err error
+	if warnAt.After(time.Now()) {
+		err = scheduleJob(ctx, warningKey, JobActionBotExpiryWarning, payload, warnAt)
+	} else {
+		err = cancelJob(ctx, warningKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to schedule expiry warning: %w", err)
+	}
+	return scheduleJob(ctx, botExpiryJobKey(JobActionExpireBot, userID), JobActionExpireBot, payload, expiresAt)
+}
+
+func getExpiringBot(ctx context.Context, job *Job) (*BotExpiryPayload, *Bot, error) {
+	var payload BotExpiryPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse payload: %w", err)
+	}
+	bot, err := db.GetBot(ctx, payload.BotMXID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get bot: %w", err)
+	} else if bot == nil || bot.Deactivated || bot.ExpiresAt.IsZero() {
+		zerolog.Ctx(ctx).Debug().Msg("Bot no longer exists or doesn't expire, ignoring job")
+		return &payload, nil, nil
+	}
+	return &payload, bot, nil
+}
+
+func runBotExpiryWarningJob(ctx context.Context, job *Job) error {
+	payload, bot, err := getExpiringBot(ctx, job)
+	if err != nil || bot == nil {
+		return err
+	}
+	return notifyExpiringBotOwner(ctx, payload, bot, botExpiryWarning, bot.MXID, util.FormatDuration(time.Until(bot.ExpiresAt).Round(time.Minute)), bot.MXID.Localpart())
+}
+
+func notifyExpiringBotOwner(ctx context.Context, payload *BotExpiryPayload, bot *Bot, message string, args ...any) error {
+	if payload.RoomID == "" {
+		return notifyUser(ctx, bot.OwnerMXID, message, args...)
+	}
+	_, err := sendNotice(ctx, payload.RoomID, message, args...)
+	return err
+}
+
+func deactivateBotAccount(ctx context.Context, botMXID id.UserID) error {
+	err := DeactivateUser(ctx, botMXID)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate bot: %w", err)
+	}
+	err = db.MarkBotDeactivated(ctx, botMXID)
+	if err != nil {
+		return fmt.Errorf("failed to mark bot as deactivated: %w", err)
+	}
+	return nil
+}
+
+func runExpireBotJob(ctx context.Context, job *Job) error {
+	payload, bot, err := getExpiringBot(ctx, job)
+	if err != nil || bot == nil {
+		return err
+	} else if time.Now().Before(bot.ExpiresAt) {
+		zerolog.Ctx(ctx).Debug().Time("expires_at", bot.ExpiresAt).Msg("Bot expiry was extended, ignoring job")
+		return nil
+	}
+	err = deactivateBotAccount(ctx, bot.MXID)
+	if err != nil {
+		return err
+	}
+	auditSystem(ctx, AuditBotDeactivated, bot.MXID, "bot expired")
+	err = notifyExpiringBotOwner(ctx, payload, bot, botExpired, bot.MXID)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to notify owner about expired bot")
+	}
+	return nil
+}
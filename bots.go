@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/synapseadmin"
+	"maunium.net/go/mautrix/util"
+)
+
+// The message of a UserError can be shown as-is, both in chat and in the provisioning API.
+type UserError struct {
+	StatusCode int
+	ErrCode    string
+	Message    string
+}
+
+func (err *UserError) Error() string {
+	return err.Message
+}
+
+var (
+	errBotNotFound        = &UserError{http.StatusNotFound, "M_NOT_FOUND", "That bot doesn't exist"}
+	errNotYourBot         = &UserError{http.StatusForbidden, "M_FORBIDDEN", "That's not your bot"}
+	errBotDeactivated     = &UserError{http.StatusForbidden, "M_FORBIDDEN", "That bot has been deactivated"}
+	errBotSuspended       = &UserError{http.StatusForbidden, "M_FORBIDDEN", "That bot has been suspended"}
+	errTooManyBots        = &UserError{http.StatusForbidden, "M_LIMIT_EXCEEDED", "You have too many bots already"}
+	errUsernameInvalid    = &UserError{http.StatusBadRequest, "M_INVALID_USERNAME", usernameInvalidError}
+	errUsernameTaken      = &UserError{http.StatusConflict, "M_USER_IN_USE", "That username is already taken"}
+	errBotAlreadyOwned    = &UserError{http.StatusConflict, "M_USER_IN_USE", "You've already registered that bot. You can use `reset <username>` to reset the token."}
+	errBotCreationPending = &UserError{http.StatusConflict, "M_USER_IN_USE", "There's already a pending request to create that bot"}
+)
+
+func getVisibleBots(ctx context.Context, userID id.UserID) ([]Bot, error) {
+	bots, err := db.GetSharedBots(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared bots: %w", err)
+	}
+	teamBots, err := getTeamBotsOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return mergeBots(bots, teamBots), nil
+}
+
+func authorizeBot(ctx context.Context, userID id.UserID, username string, minRole BotRole, allowSuspended bool) (*Bot, error) {
+	bot, err := db.GetBot(ctx, id.NewUserID(strings.ToLower(username), cli.UserID.Homeserver()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bot info: %w", err)
+	} else if bot == nil {
+		return nil, errBotNotFound
+	}
+	role, err := getUserBotRole(ctx, bot, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check access to bot: %w", err)
+	} else if role == RoleNone {
+		return nil, errNotYourBot
+	} else if !role.AtLeast(minRole) {
+		return nil, &UserError{
+			StatusCode: http.StatusForbidden,
+			ErrCode:    "M_FORBIDDEN",
+			Message:    fmt.Sprintf("You need to be %s of that bot to do that, but you're only %s", withArticle(minRole), withArticle(role)),
+		}
+	} else if bot.Deactivated {
+		return nil, errBotDeactivated
+	} else if bot.SuspendedBy != "" && !allowSuspended {
+		return nil, errBotSuspended
+	}
+	return bot, nil
+}
+
+// approvedRequestID is needed so that the request itself doesn't count as a pending request for the username.
+func validateNewBot(ctx context.Context, owner id.UserID, username string, approvedRequestID int64) error {
+	if cfg.MaxBotsPerUser > 0 {
+		botCount, err := db.CountActiveBots(ctx, owner)
+		if err != nil {
+			return fmt.Errorf("failed to get bot list: %w", err)
+		} else if botCount >= cfg.MaxBotsPerUser {
+			return errTooManyBots
+		}
+	}
+	if !IsValidBotUsername(username) {
+		return errUsernameInvalid
+	}
+	existingBot, err := db.GetBot(ctx, id.NewUserID(username, cli.UserID.Homeserver()))
+	if err != nil {
+		return fmt.Errorf("failed to check if bot already exists in database: %w", err)
+	} else if existingBot != nil && existingBot.OwnerMXID == owner {
+		return errBotAlreadyOwned
+	} else if existingBot != nil {
+		return errUsernameTaken
+	}
+	pendingReq, err := db.GetCreateRequestByUsername(ctx, username)
+	if err != nil {
+		return fmt.Errorf("failed to check if bot creation is already pending approval: %w", err)
+	} else if pendingReq != nil && pendingReq.ID != approvedRequestID {
+		return errBotCreationPending
+	}
+	available, err := IsUsernameAvailable(ctx, username)
+	if err != nil {
+		return fmt.Errorf("failed to check username availability: %w", err)
+	} else if !available {
+		return errUsernameTaken
+	}
+	return nil
+}
+
+type CreatedBot struct {
+	Device *mautrix.RespLogin
+	// ExpiresAt is zero if the bot doesn't expire, or if scheduling its expiry failed.
+	ExpiresAt time.Time
+	// Warnings are problems that didn't prevent creating the bot, phrased as sentences for the owner.
+	Warnings []string
+}
+
+func registerNewBot(ctx context.Context, owner id.UserID, params *NewBotParams) (*CreatedBot, error) {
+	userID := id.NewUserID(params.Username, cli.UserID.Homeserver())
+	setAuditTarget(ctx, AuditBotCreated, userID)
+	if err := validateNewBot(ctx, owner, params.Username, params.RequestID); err != nil {
+		return nil, err
+	}
+	var expiresAt time.Time
+	if params.Lifetime > 0 {
+		expiresAt = time.Now().Add(params.Lifetime)
+	}
+	password, err := RegisterUser(ctx, params.Username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register bot: %w", err)
+	} else if err = db.RegisterBot(ctx, owner, userID, expiresAt, params.Purpose); err != nil {
+		return nil, fmt.Errorf("failed to store registered bot in database: %w", err)
+	}
+	created := &CreatedBot{}
+	// The expiry is scheduled before logging in so that the bot still expires if the rest of the setup fails
+	if !expiresAt.IsZero() {
+		if err = scheduleBotExpiry(ctx, userID, getEventRoomID(ctx), expiresAt); err != nil {
+			zerolog.Ctx(ctx).Err(err).Msg("Failed to schedule bot expiry")
+			created.Warnings = append(created.Warnings, "However, scheduling its expiry failed, so it won't be deactivated automatically.")
+		} else {
+			created.ExpiresAt = expiresAt
+		}
+	}
+	created.Device, err = Login(ctx, userID, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to log in as bot after registering: %w", err)
+	}
+	var details []string
+	if !expiresAt.IsZero() {
+		details = append(details, "expires at "+expiresAt.UTC().Format(time.UnixDate))
+	}
+	if params.Purpose != "" {
+		details = append(details, "purpose: "+params.Purpose)
+	}
+	auditCommand(ctx, AuditBotCreated, userID, strings.Join(details, ", "))
+	if err = applyBotDefaults(ctx, userID); err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to apply default settings to new bot")
+		created.Warnings = append(created.Warnings, "However, applying some of the default settings failed, so it may not have the default push rules, presence or account data.")
+	}
+	return created, nil
+}
+
+func resetBot(ctx context.Context, bot *Bot) (*mautrix.RespLogin, error) {
+	setAuditTarget(ctx, AuditBotReset, bot.MXID)
+	password := util.RandomString(72)
+	err := synadm.ResetPassword(ctx, synapseadmin.ReqResetPassword{
+		UserID:        bot.MXID,
+		NewPassword:   password,
+		LogoutDevices: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset password: %w", err)
+	}
+	device, err := Login(ctx, bot.MXID, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create device after resetting password: %w", err)
+	}
+	auditCommand(ctx, AuditBotReset, bot.MXID, "new device %s", device.DeviceID)
+	return device, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"maunium.net/go/mautrix/id"
+)
+
+const adminHelp = `**Usage:**
+
+* ´admin audit [--bot=<username>] [--actor=<user ID>] [--action=<action>] [--before=<ID>]´: Search the audit log
+* ´admin export´: Export all bots as an encrypted JSON file`
+
+type BotExport struct {
+	MXID        id.UserID `json:"mxid"`
+	Owner       id.UserID `json:"owner"`
+	OwnerRoom   id.RoomID `json:"owner_room,omitempty"`
+	Purpose     string    `json:"purpose,omitempty"`
+	ExpiresAt   int64     `json:"expires_at,omitempty"`
+	Deactivated bool      `json:"deactivated"`
+	SuspendedBy id.UserID `json:"suspended_by,omitempty"`
+}
+
+func cmdAdmin(ctx context.Context, args []string) {
+	if !isAdmin(getEvent(ctx).Sender) {
+		reply(ctx, "Only admins can use admin commands")
+		return
+	} else if len(args) < 1 {
+		reply(ctx, adminHelp)
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "audit":
+		cmdAdminAudit(ctx, args[1:])
+	case "export":
+		cmdAdminExport(ctx)
+	default:
+		reply(ctx, adminHelp)
+	}
+}
+
+func cmdAdminAudit(ctx context.Context, args []string) {
+	_, flags := parseFlags(args)
+	before, ok := parseAuditBefore(ctx, flags)
+	if !ok {
+		return
+	}
+	filter := &AuditFilter{
+		Actor:  id.UserID(flags["actor"]),
+		Action: AuditAction(strings.ToLower(flags["action"])),
+		Before: before,
+	}
+	command := "admin audit"
+	if bot := flags["bot"]; bot != "" {
+		if strings.HasPrefix(bot, "@") {
+			filter.Bot = id.UserID(bot)
+		} else {
+			filter.Bot = id.NewUserID(strings.ToLower(bot), cli.UserID.Homeserver())
+		}
+		command += fmt.Sprintf(" --bot=%s", filter.Bot)
+	}
+	if filter.Actor != "" {
+		command += fmt.Sprintf(" --actor=%s", filter.Actor)
+	}
+	if filter.Action != "" {
+		command += fmt.Sprintf(" --action=%s", filter.Action)
+	}
+	replyAuditLog(ctx, filter, command)
+}
+
+func cmdAdminExport(ctx context.Context) {
+	bots, err := db.GetAllBots(ctx)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get bots")
+		return
+	}
+	export := make([]BotExport, len(bots))
+	for i, bot := range bots {
+		export[i] = BotExport{
+			MXID:        bot.MXID,
+			Owner:       bot.OwnerMXID,
+			OwnerRoom:   bot.OwnerRoom,
+			Purpose:     bot.Purpose,
+			Deactivated: bot.Deactivated,
+			SuspendedBy: bot.SuspendedBy,
+		}
+		if !bot.ExpiresAt.IsZero() {
+			export[i].ExpiresAt = bot.ExpiresAt.UnixMilli()
+		}
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		replyErr(ctx, err, "Failed to encode bot list")
+		return
+	}
+	file, err := uploadEncryptedFile(data)
+	if err != nil {
+		replyErr(ctx, err, "Failed to upload bot list")
+		return
+	}
+	replyFile(ctx, "botbot-export.json", "application/json", len(data), file)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/exp/slices"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/util"
+)
+
+const createRequestNotice = `%s requested a new bot ´%s´%s.%s
+
+Use ´approve %d´ to create it or ´deny %d [<reason>]´ to reject the request.`
+
+const createDeniedNotice = "Your request to create ´%s´ was denied by %s.%s"
+
+func getCreateApprovers() []string {
+	if len(cfg.CreateApprovers) > 0 {
+		return cfg.CreateApprovers
+	}
+	return cfg.Admins
+}
+
+func isCreateApprover(userID id.UserID) bool {
+	return slices.Contains(getCreateApprovers(), userID.String())
+}
+
+func formatBotLifetime(lifetime time.Duration) string {
+	if lifetime == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" that expires after %s", util.FormatDuration(lifetime))
+}
+
+func formatBotPurpose(purpose string) string {
+	if purpose == "" {
+		return ""
+	}
+	return "\n\n> " + purpose
+}
+
+func requestBotCreation(ctx context.Context, params *NewBotParams) {
+	userID := id.NewUserID(params.Username, cli.UserID.Homeserver())
+	setAuditTarget(ctx, AuditCreateRequested, userID)
+	approvers := getCreateApprovers()
+	if len(approvers) == 0 {
+		reply(ctx, "There are no approvers who could approve creating a bot")
+		return
+	} else if !checkNewBot(ctx, params.Username) {
+		return
+	}
+	evt := getEvent(ctx)
+	req := &CreateRequest{
+		RequestedBy: evt.Sender,
+		Username:    params.Username,
+		Lifetime:    params.Lifetime,
+		Purpose:     params.Purpose,
+		Flags:       params.Flags,
+		RoomID:      evt.RoomID,
+		EventID:     evt.ID,
+		RequestedAt: time.Now(),
+	}
+	if evt.Mautrix.TrustSource != nil {
+		req.DeviceID = evt.Mautrix.TrustSource.DeviceID
+	}
+	if err := db.InsertCreateRequest(ctx, req); err != nil {
+		replyErr(ctx, err, "Failed to save bot creation request")
+		return
+	}
+	auditCommand(ctx, AuditCreateRequested, userID, "request #%d", req.ID)
+	noticeArgs := []any{evt.Sender, userID, formatBotLifetime(params.Lifetime), formatBotPurpose(params.Purpose), req.ID, req.ID}
+	notified := 0
+	if cfg.AdminRoom != "" && canPostInAdminRoom(ctx) {
+		if _, err := sendNotice(ctx, cfg.AdminRoom, createRequestNotice, noticeArgs...); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to post bot creation request in admin room")
+		} else {
+			notified++
+		}
+	}
+	for _, approver := range approvers {
+		if id.UserID(approver) == evt.Sender {
+			continue
+		} else if err := notifyUser(ctx, id.UserID(approver), createRequestNotice, noticeArgs...); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("approver_mxid", approver).Msg("Failed to notify approver about bot creation request")
+		} else {
+			notified++
+		}
+	}
+	if notified == 0 {
+		reply(ctx, "Saved your request (#%d), but failed to notify any approvers about it. Please contact an admin directly.", req.ID)
+	} else {
+		reply(ctx, "Creating `%s` requires approval. Your request is #%d, you'll get the credentials here once it's approved.", userID, req.ID)
+	}
+}
+
+func getCreateRequestForApprover(ctx context.Context, args []string, usage string) *CreateRequest {
+	if !isCreateApprover(getEvent(ctx).Sender) {
+		reply(ctx, "Only approvers can approve or deny bot creation requests")
+		return nil
+	} else if len(args) < 1 {
+		reply(ctx, "**Usage:** `%s`", usage)
+		return nil
+	}
+	requestID, err := strconv.ParseInt(strings.TrimPrefix(args[0], "#"), 10, 64)
+	if err != nil {
+		reply(ctx, "Invalid request ID `%s`", args[0])
+		return nil
+	}
+	req, err := db.GetCreateRequest(ctx, requestID)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get bot creation request")
+	} else if req == nil {
+		reply(ctx, "There's no pending bot creation request #%d", requestID)
+	} else {
+		return req
+	}
+	return nil
+}
+
+func listCreateRequests(ctx context.Context) {
+	if !isCreateApprover(getEvent(ctx).Sender) {
+		reply(ctx, "Only approvers can approve or deny bot creation requests")
+		return
+	}
+	requests, err := db.GetCreateRequests(ctx)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get bot creation requests")
+		return
+	} else if len(requests) == 0 {
+		reply(ctx, "There are no pending bot creation requests")
+		return
+	}
+	lines := make([]string, len(requests))
+	for i, req := range requests {
+		lines[i] = fmt.Sprintf(
+			"* #%d: ´%s´%s, requested by %s at %s", req.ID, id.NewUserID(req.Username, cli.UserID.Homeserver()),
+			formatBotLifetime(req.Lifetime), req.RequestedBy, req.RequestedAt.UTC().Format(time.UnixDate),
+		)
+		if req.Purpose != "" {
+			lines[i] += ": " + req.Purpose
+		}
+	}
+	reply(ctx, "Pending bot creation requests:\n\n%s", strings.Join(lines, "\n"))
+}
+
+// Replies in the request context go to the create command, so that the credentials are sent to the requester
+// like they would be without approval.
+func requestContext(ctx context.Context, req *CreateRequest) context.Context {
+	evt := &event.Event{
+		Sender:  req.RequestedBy,
+		Type:    event.EventMessage,
+		ID:      req.EventID,
+		RoomID:  req.RoomID,
+		Content: event.Content{Parsed: &event.MessageEventContent{MsgType: event.MsgText}},
+	}
+	if req.DeviceID != "" {
+		device, err := cryptoHelper.Machine().CryptoStore.GetDevice(req.RequestedBy, req.DeviceID)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to get device of requester")
+		}
+		evt.Mautrix.TrustSource = device
+	}
+	ctx = context.WithValue(ctx, contextKeyEvent, evt)
+	return context.WithValue(ctx, contextKeyCommandAudit, &commandAudit{})
+}
+
+func cmdApprove(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		listCreateRequests(ctx)
+		return
+	}
+	req := getCreateRequestForApprover(ctx, args, "approve <request ID>")
+	if req == nil {
+		return
+	}
+	sender := getEvent(ctx).Sender
+	userID := id.NewUserID(req.Username, cli.UserID.Homeserver())
+	if req.RequestedBy == sender {
+		reply(ctx, "You can't approve your own request")
+		return
+	}
+	setAuditTarget(ctx, AuditCreateApproved, userID)
+	reqCtx := requestContext(ctx, req)
+	credOpts, ok := getCredentialOptions(reqCtx, req.Flags)
+	if !ok {
+		reply(ctx, "Can't deliver the credentials of `%s` the way %s asked for, so it wasn't created. Request #%d is still pending, use `deny %d` to reject it.", userID, req.RequestedBy, req.ID, req.ID)
+		return
+	}
+	params := &NewBotParams{
+		Username:  req.Username,
+		Lifetime:  req.Lifetime,
+		Purpose:   req.Purpose,
+		Flags:     req.Flags,
+		CredOpts:  credOpts,
+		RequestID: req.ID,
+	}
+	created, err := registerNewBot(reqCtx, req.RequestedBy, params)
+	var userErr *UserError
+	if errors.As(err, &userErr) {
+		reply(ctx, "Can't create `%s`: %s. Request #%d is still pending, use `deny %d` to reject it.", userID, strings.TrimSuffix(userErr.Message, "."), req.ID, req.ID)
+		return
+	} else if err != nil {
+		replyErr(ctx, err, fmt.Sprintf("Failed to create `%s`, request #%d is still pending", userID, req.ID))
+		return
+	}
+	// The bot exists now, so a leftover request only blocks the username and shouldn't fail the approval
+	if err = db.DeleteCreateRequest(ctx, req.ID); err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to delete bot creation request after creating bot")
+	}
+	auditCommand(ctx, AuditCreateApproved, userID, "request #%d from %s", req.ID, req.RequestedBy)
+	reply(ctx, "Approved request #%d and created `%s` for %s", req.ID, userID, req.RequestedBy)
+	sendCreatedBot(reqCtx, params, created)
+}
+
+func cmdDeny(ctx context.Context, args []string) {
+	req := getCreateRequestForApprover(ctx, args, "deny <request ID> [<reason>]")
+	if req == nil {
+		return
+	}
+	userID := id.NewUserID(req.Username, cli.UserID.Homeserver())
+	setAuditTarget(ctx, AuditCreateDenied, userID)
+	if err := db.DeleteCreateRequest(ctx, req.ID); err != nil {
+		replyErr(ctx, err, "Failed to delete bot creation request")
+		return
+	}
+	auditCommand(ctx, AuditCreateDenied, userID, "request #%d from %s", req.ID, req.RequestedBy)
+	reply(ctx, "Denied request #%d", req.ID)
+	var reason string
+	if len(args) > 1 {
+		reason = "\n\n> " + strings.Join(args[1:], " ")
+	}
+	if _, err := sendNotice(ctx, req.RoomID, createDeniedNotice, userID, getEvent(ctx).Sender, reason); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to notify user about denied bot creation request")
+	}
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/util"
 )
 
 const usernameInvalidError = `That username is not valid. Usernames must:
@@ -14,55 +17,129 @@ const usernameInvalidError = `That username is not valid. Usernames must:
 * Not start with dash
 * End with ´bot´`
 
-const botDetailsSelfDestruct = 5 * time.Minute
-
 const botDetails = `
 
 * User ID: ´%s´
 * Device ID: ´%s´
 * Access token: ´%s´
 
-This message will self-destruct in 5 minutes.`
+This message will self-destruct %s.`
+
+const purposePrompt = "What will ´%s´ be used for? Describe the purpose of the bot in one message, or use ´cancel´ to cancel."
+
+const expiryPrompt = "How long should ´%s´ exist? Reply with a duration like ´30d´, or ´never´ if it shouldn't be deactivated automatically."
+
+// NewBotParams may be collected over multiple messages.
+type NewBotParams struct {
+	Username string
+	Lifetime time.Duration
+	Purpose  string
+	// Flags are the raw flags of the create command, needed to re-parse the credential options after approval.
+	Flags     map[string]string
+	CredOpts  *CredentialOptions
+	RequestID int64
+}
 
 func cmdCreate(ctx context.Context, args []string) {
+	args, flags := parseFlags(args)
 	if len(args) < 1 {
-		reply(ctx, "**Usage:** `create <username>`")
+		reply(ctx, "**Usage:** `create <username> [--expires <duration>] [--format=env|json|yaml|mautrix-go] [--deliver=message|to-device] [--expire=<duration>|read]`")
 		return
 	}
-	if cfg.MaxBotsPerUser > 0 {
-		bots, err := db.GetBots(ctx, getEvent(ctx).Sender)
-		if err != nil {
-			replyErr(ctx, err, "Failed to get bot list")
-			return
-		} else if len(bots) >= cfg.MaxBotsPerUser {
-			reply(ctx, "You have too many bots already")
+	var lifetime time.Duration
+	if flags["expires"] != "" {
+		var err error
+		lifetime, err = parseDuration(flags["expires"])
+		if err != nil || lifetime <= 0 {
+			reply(ctx, "Invalid bot lifetime `%s`. Use a duration like `12h` or `7d`.", flags["expires"])
 			return
 		}
 	}
-	username := args[0]
-	userID := id.NewUserID(username, cli.UserID.Homeserver())
-	if !IsValidBotUsername(username) {
-		reply(ctx, usernameInvalidError)
-	} else if existingBot, err := db.GetBot(ctx, userID); err != nil {
-		replyErr(ctx, err, "Failed to check if bot already exists in database")
-	} else if existingBot != nil {
-		if existingBot.OwnerMXID == getEvent(ctx).Sender {
-			reply(ctx, "You've already registered that bot. You can use `reset <username>` to reset the token.")
-		} else {
-			reply(ctx, "That username is already taken")
+	credOpts, ok := getCredentialOptions(ctx, flags)
+	if !ok {
+		return
+	}
+	params := &NewBotParams{Username: args[0], Lifetime: lifetime, Flags: flags, CredOpts: credOpts}
+	if !cfg.CreateRequirePurpose {
+		finishCreate(ctx, params)
+		return
+	} else if !checkNewBot(ctx, params.Username) {
+		return
+	}
+	userID := id.NewUserID(params.Username, cli.UserID.Homeserver())
+	cmdCtx := getUserCommandContext(ctx)
+	cmdCtx.Next = cmdCreatePurpose
+	cmdCtx.Data["create_params"] = params
+	cmdCtx.Action = fmt.Sprintf("creating `%s`", userID)
+	reply(ctx, purposePrompt, userID)
+}
+
+func cmdCreatePurpose(ctx context.Context, _ []string) {
+	cmdCtx := getUserCommandContext(ctx)
+	params := cmdCtx.Data["create_params"].(*NewBotParams)
+	params.Purpose = strings.TrimSpace(getEvent(ctx).Content.AsMessage().Body)
+	if params.Purpose == "" {
+		reply(ctx, "Please describe what the bot will be used for, or use `cancel` to cancel.")
+		return
+	} else if params.Lifetime == 0 {
+		cmdCtx.Next = cmdCreateExpiry
+		reply(ctx, expiryPrompt, id.NewUserID(params.Username, cli.UserID.Homeserver()))
+		return
+	}
+	cmdCtx.Clear()
+	finishCreate(ctx, params)
+}
+
+func cmdCreateExpiry(ctx context.Context, args []string) {
+	cmdCtx := getUserCommandContext(ctx)
+	params := cmdCtx.Data["create_params"].(*NewBotParams)
+	if len(args) != 1 {
+		reply(ctx, "Please reply with a duration like `30d` or `never`, or use `cancel` to cancel.")
+		return
+	} else if value := strings.ToLower(args[0]); value != "never" {
+		lifetime, err := parseDuration(value)
+		if err != nil || lifetime <= 0 {
+			reply(ctx, "Invalid bot lifetime `%s`. Use a duration like `12h` or `7d`, or `never`.", args[0])
+			return
 		}
-	} else if available, err := IsUsernameAvailable(ctx, username); err != nil {
-		replyErr(ctx, err, "Failed to check username availability")
-	} else if !available {
-		reply(ctx, "That username is already taken")
-	} else if password, err := RegisterUser(ctx, username); err != nil {
-		replyErr(ctx, err, "Failed to register bot")
-	} else if err = db.RegisterBot(ctx, getEvent(ctx).Sender, userID); err != nil {
-		replyErr(ctx, err, "Failed to store registered bot in database")
-	} else if device, err := Login(ctx, userID, password); err != nil {
-		replyErr(ctx, err, "Failed to log in as bot after registering")
+		params.Lifetime = lifetime
+	}
+	cmdCtx.Clear()
+	finishCreate(ctx, params)
+}
+
+func finishCreate(ctx context.Context, params *NewBotParams) {
+	if cfg.CreateApproval {
+		requestBotCreation(ctx, params)
 	} else {
-		evtID := reply(ctx, "Bot created successfully 🎉"+botDetails, device.UserID, device.DeviceID, device.AccessToken)
-		selfDestruct(ctx, evtID, botDetailsSelfDestruct)
+		createBot(ctx, params)
+	}
+}
+
+func checkNewBot(ctx context.Context, username string) bool {
+	if err := validateNewBot(ctx, getEvent(ctx).Sender, username, 0); err != nil {
+		replyError(ctx, err, "Failed to check if the bot can be created")
+		return false
+	}
+	return true
+}
+
+func createBot(ctx context.Context, params *NewBotParams) {
+	created, err := registerNewBot(ctx, getEvent(ctx).Sender, params)
+	if err != nil {
+		replyError(ctx, err, "Failed to create bot")
+		return
+	}
+	sendCreatedBot(ctx, params, created)
+}
+
+func sendCreatedBot(ctx context.Context, params *NewBotParams, created *CreatedBot) {
+	message := "Bot created successfully 🎉"
+	for _, warning := range created.Warnings {
+		message += " " + warning
+	}
+	if !created.ExpiresAt.IsZero() {
+		message += fmt.Sprintf(" It will be deactivated in %s.", util.FormatDuration(params.Lifetime))
 	}
+	sendBotDetails(ctx, message, created.Device, params.CredOpts)
 }
@@ -4,6 +4,13 @@ import (
 	"context"
 )
 
-func cmdDelete(ctx context.Context, _ []string) {
+func cmdDelete(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		reply(ctx, "**Usage:** `delete <username>`")
+		return
+	}
+	if getBotMeta(ctx, args[0], RoleOwner) == nil {
+		return
+	}
 	reply(ctx, "Deleting bots is not yet supported")
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+func cmdDigest(ctx context.Context, args []string) {
+	sender := getEvent(ctx).Sender
+	if len(args) < 1 {
+		user, err := db.GetUser(ctx, sender)
+		if err != nil {
+			replyErr(ctx, err, "Failed to get your preferences")
+		} else if user.DigestInterval == DigestDisabled {
+			reply(ctx, "Digests are disabled. Use `digest on|daily|weekly` to enable them.")
+		} else {
+			reply(ctx, "You're receiving a %s digest of your bots. Use `digest off` to disable it.", user.DigestInterval)
+		}
+		return
+	}
+	var interval DigestInterval
+	switch strings.ToLower(args[0]) {
+	case "on", "weekly":
+		interval = DigestWeekly
+	case "daily":
+		interval = DigestDaily
+	case "off":
+		interval = DigestDisabled
+	default:
+		reply(ctx, "**Usage:** `digest [on|off|weekly|daily]`")
+		return
+	}
+	if err := updateDigestPreference(ctx, sender, interval); err != nil {
+		replyErr(ctx, err, "Failed to save digest preference")
+	} else if interval == DigestDisabled {
+		reply(ctx, "Digests disabled")
+	} else {
+		reply(ctx, "You'll now receive a %s digest of your bots in this room", interval)
+	}
+}
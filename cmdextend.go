@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"maunium.net/go/mautrix/util"
+)
+
+func cmdExtend(ctx context.Context, args []string) {
+	if len(args) < 2 {
+		reply(ctx, "**Usage:** `extend <username> <duration>`")
+		return
+	}
+	extension, err := parseDuration(args[1])
+	if err != nil || extension <= 0 {
+		reply(ctx, "Invalid duration `%s`. Use a duration like `12h` or `7d`.", args[1])
+		return
+	}
+	bot := getBotMeta(ctx, args[0], RoleMaintainer)
+	if bot == nil {
+		return
+	} else if bot.ExpiresAt.IsZero() {
+		reply(ctx, "That bot doesn't expire")
+		return
+	}
+	setAuditTarget(ctx, AuditBotExtended, bot.MXID)
+	expiresAt := bot.ExpiresAt
+	if expiresAt.Before(time.Now()) {
+		expiresAt = time.Now()
+	}
+	expiresAt = expiresAt.Add(extension)
+	if err = db.SetBotExpiry(ctx, bot.MXID, expiresAt); err != nil {
+		replyErr(ctx, err, "Failed to update bot expiry")
+	} else if err = scheduleBotExpiry(ctx, bot.MXID, getEvent(ctx).RoomID, expiresAt); err != nil {
+		replyErr(ctx, err, "Failed to reschedule bot expiry")
+	} else {
+		auditCommand(ctx, AuditBotExtended, bot.MXID, "expires at %s", expiresAt.UTC().Format(time.UnixDate))
+		reply(ctx, "`%s` will now be deactivated in %s", bot.MXID, util.FormatDuration(time.Until(expiresAt).Round(time.Minute)))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const auditPageSize = 20
+
+func parseAuditBefore(ctx context.Context, flags map[string]string) (int64, bool) {
+	before, ok := flags["before"]
+	if !ok {
+		return 0, true
+	}
+	beforeID, err := strconv.ParseInt(before, 10, 64)
+	if err != nil || beforeID <= 0 {
+		reply(ctx, "Invalid entry ID `%s`", before)
+		return 0, false
+	}
+	return beforeID, true
+}
+
+func replyAuditLog(ctx context.Context, filter *AuditFilter, command string) {
+	filter.Limit = auditPageSize
+	entries, err := db.GetAuditLog(ctx, filter)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get audit log")
+		return
+	} else if len(entries) == 0 {
+		if filter.Before > 0 {
+			reply(ctx, "No older audit log entries")
+		} else {
+			reply(ctx, "No audit log entries found")
+		}
+		return
+	}
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = fmt.Sprintf("* ´#%d´ %s: %s", entry.ID, time.UnixMilli(entry.Timestamp).UTC().Format(time.UnixDate), entry.String())
+	}
+	message := strings.Join(lines, "\n")
+	if len(entries) == auditPageSize {
+		message += fmt.Sprintf("\n\nUse ´%s --before %d´ to see older entries.", command, entries[len(entries)-1].ID)
+	}
+	reply(ctx, message)
+}
+
+func cmdHistory(ctx context.Context, args []string) {
+	args, flags := parseFlags(args)
+	if len(args) < 1 {
+		reply(ctx, "**Usage:** `history <username> [--before <ID>]`")
+		return
+	}
+	before, ok := parseAuditBefore(ctx, flags)
+	if !ok {
+		return
+	}
+	bot := getOwnedBot(ctx, args[0], RoleOwner)
+	if bot == nil {
+		return
+	}
+	replyAuditLog(ctx, &AuditFilter{Bot: bot.MXID, Before: before}, "history "+bot.MXID.Localpart())
+}
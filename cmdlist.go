@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/id"
 )
 
 func cmdList(ctx context.Context, args []string) {
-	bots, err := db.GetBots(ctx, getEvent(ctx).Sender)
+	sender := getEvent(ctx).Sender
+	bots, err := getVisibleBots(ctx, sender)
 	if err != nil {
 		replyErr(ctx, err, "Failed to get bot list")
 	} else if len(bots) == 0 {
@@ -16,7 +20,33 @@ func cmdList(ctx context.Context, args []string) {
 		lines := make([]string, len(bots))
 		for i, bot := range bots {
 			lines[i] = fmt.Sprintf("* [%s](%s)", bot.MXID, bot.MXID.URI().MatrixToURL())
+			if bot.OwnerRoom != "" {
+				lines[i] += fmt.Sprintf(" (owned by team room %s)", bot.OwnerRoom)
+			} else if bot.OwnerMXID != sender {
+				lines[i] += fmt.Sprintf(" (shared by %s)", bot.OwnerMXID)
+			}
+			if bot.Deactivated {
+				lines[i] += " (deactivated)"
+			} else if bot.SuspendedBy != "" {
+				lines[i] += " (suspended)"
+			} else if !bot.ExpiresAt.IsZero() {
+				lines[i] += fmt.Sprintf(" (expires at %s)", bot.ExpiresAt.UTC().Format(time.UnixDate))
+			}
 		}
 		reply(ctx, "Your bots:\n\n"+strings.Join(lines, "\n"))
 	}
 }
+
+func mergeBots(bots, extra []Bot) []Bot {
+	seen := make(map[id.UserID]struct{}, len(bots))
+	for _, bot := range bots {
+		seen[bot.MXID] = struct{}{}
+	}
+	for _, bot := range extra {
+		if _, ok := seen[bot.MXID]; !ok {
+			bots = append(bots, bot)
+			seen[bot.MXID] = struct{}{}
+		}
+	}
+	return bots
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/util"
+)
+
+const temporaryLoginExpired = "The temporary token for ´%s´ (device ´%s´) has expired and was revoked."
+
+type ExpireDevicePayload struct {
+	BotMXID  id.UserID   `json:"bot_mxid"`
+	DeviceID id.DeviceID `json:"device_id"`
+	RoomID   id.RoomID   `json:"room_id"`
+}
+
+func expireDeviceJobKey(userID id.UserID, deviceID id.DeviceID) string {
+	return fmt.Sprintf("%s:%s:%s", JobActionExpireDevice, userID, deviceID)
+}
+
+func cmdLogin(ctx context.Context, args []string) {
+	args, flags := parseFlags(args)
+	if len(args) < 1 || flags["ttl"] == "" {
+		reply(ctx, "**Usage:** `login <username> --ttl <duration> [--format=env|json|yaml|mautrix-go] [--deliver=message|to-device] [--expire=<duration>|read]`")
+		return
+	}
+	ttl, err := parseDuration(flags["ttl"])
+	if err != nil || ttl <= 0 {
+		reply(ctx, "Invalid TTL `%s`. Use a duration like `2h` or `7d`.", flags["ttl"])
+		return
+	}
+	credOpts, ok := getCredentialOptions(ctx, flags)
+	if !ok {
+		return
+	}
+	bot := getBotMeta(ctx, args[0], RoleMaintainer)
+	if bot == nil {
+		return
+	}
+	setAuditTarget(ctx, AuditTokenCreated, bot.MXID)
+	device, err := LoginNewDevice(ctx, bot.MXID)
+	if err != nil {
+		replyErr(ctx, err, "Failed to create temporary device")
+		return
+	}
+	expiresAt := time.Now().Add(ttl)
+	err = scheduleJob(ctx, expireDeviceJobKey(device.UserID, device.DeviceID), JobActionExpireDevice, &ExpireDevicePayload{
+		BotMXID:  device.UserID,
+		DeviceID: device.DeviceID,
+		RoomID:   getEvent(ctx).RoomID,
+	}, expiresAt)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to schedule temporary device expiry")
+		if err = DeleteDevice(ctx, device.UserID, device.DeviceID); err != nil {
+			zerolog.Ctx(ctx).Err(err).Msg("Failed to delete temporary device after failing to schedule expiry")
+		}
+		reply(ctx, "Failed to schedule expiry for temporary token")
+		return
+	}
+	auditCommand(ctx, AuditTokenCreated, bot.MXID, "device %s, expires in %s", device.DeviceID, util.FormatDuration(ttl))
+	sendBotDetails(ctx, fmt.Sprintf("Temporary token created, it will expire in %s.", util.FormatDuration(ttl)), device, credOpts)
+}
+
+func runExpireDeviceJob(ctx context.Context, job *Job) error {
+	var payload ExpireDevicePayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+	err := DeleteDevice(ctx, payload.BotMXID, payload.DeviceID)
+	if errors.Is(err, mautrix.MNotFound) {
+		zerolog.Ctx(ctx).Debug().Msg("Temporary device was already deleted")
+	} else if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+	_, err = sendNotice(ctx, payload.RoomID, temporaryLoginExpired, payload.BotMXID, payload.DeviceID)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to notify owner about expired temporary token")
+	}
+	return nil
+}
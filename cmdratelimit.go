@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/id"
+)
+
+const ratelimitRequestNotice = `%s requested a ratelimit override for ´%s´:
+
+> %s
+
+Use ´ratelimit approve %s [<messages per second> <burst count>]´ to approve it, or ´ratelimit deny %s [<reason>]´ to deny it.
+Approving without limits disables ratelimiting for the bot completely.`
+
+const ratelimitApprovedNotice = "Your ratelimit override request for ´%s´ was approved by %s. The bot is now limited to %s."
+const ratelimitDeniedNotice = "Your ratelimit override request for ´%s´ was denied by %s.%s"
+
+const ratelimitUsage = `**Usage:**
+
+* ´ratelimit <username>´: Show the ratelimit override of a bot
+* ´ratelimit <username> <justification>´: Ask the admins to override the ratelimits of a bot
+* ´ratelimit approve <username> [<messages per second> <burst count>]´: Approve a request (admins only)
+* ´ratelimit deny <username> [<reason>]´: Deny a request (admins only)
+* ´ratelimit remove <username>´: Remove the override of a bot (admins only)`
+
+func (ro *RatelimitOverride) String() string {
+	if ro == nil {
+		return "the default ratelimits"
+	} else if ro.MessagesPerSecond == 0 && ro.BurstCount == 0 {
+		return "no ratelimits"
+	}
+	return fmt.Sprintf("%d messages per second with a burst of %d", ro.MessagesPerSecond, ro.BurstCount)
+}
+
+func cmdRatelimit(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		reply(ctx, ratelimitUsage)
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "approve":
+		cmdRatelimitApprove(ctx, args[1:])
+	case "deny":
+		cmdRatelimitDeny(ctx, args[1:])
+	case "remove":
+		cmdRatelimitRemove(ctx, args[1:])
+	default:
+		if len(args) < 2 {
+			cmdRatelimitStatus(ctx, args[0])
+		} else {
+			cmdRatelimitRequest(ctx, args[0], strings.Join(args[1:], " "))
+		}
+	}
+}
+
+func cmdRatelimitStatus(ctx context.Context, username string) {
+	bot := getBotMeta(ctx, username, RoleViewer)
+	if bot == nil {
+		return
+	}
+	override, err := GetRatelimitOverride(ctx, bot.MXID)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get ratelimit override")
+		return
+	}
+	req, err := db.GetRatelimitRequest(ctx, bot.MXID)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get pending ratelimit request")
+		return
+	}
+	status := fmt.Sprintf("`%s` has %s.", bot.MXID, override)
+	if req != nil {
+		status += fmt.Sprintf(" A request for an override is pending since %s.", req.RequestedAt.UTC().Format(time.UnixDate))
+	} else {
+		status += fmt.Sprintf(" Use `ratelimit %s <justification>` to request an override.", bot.MXID.Localpart())
+	}
+	reply(ctx, status)
+}
+
+func cmdRatelimitRequest(ctx context.Context, username, justification string) {
+	bot := getBotMeta(ctx, username, RoleMaintainer)
+	if bot == nil {
+		return
+	} else if len(cfg.Admins) == 0 {
+		reply(ctx, "There are no admins who could approve a ratelimit override")
+		return
+	}
+	setAuditTarget(ctx, AuditRatelimitAsked, bot.MXID)
+	sender := getEvent(ctx).Sender
+	err := db.UpsertRatelimitRequest(ctx, &RatelimitRequest{
+		BotMXID:       bot.MXID,
+		RequestedBy:   sender,
+		Justification: justification,
+		RequestedAt:   time.Now(),
+	})
+	if err != nil {
+		replyErr(ctx, err, "Failed to save ratelimit request")
+		return
+	}
+	notified := 0
+	for _, admin := range cfg.Admins {
+		err = notifyUser(ctx, id.UserID(admin), ratelimitRequestNotice, sender, bot.MXID, justification, bot.MXID.Localpart(), bot.MXID.Localpart())
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("admin_mxid", admin).Msg("Failed to notify admin about ratelimit request")
+		} else {
+			notified++
+		}
+	}
+	auditCommand(ctx, AuditRatelimitAsked, bot.MXID, "%s", justification)
+	if notified == 0 {
+		reply(ctx, "Saved your request, but failed to notify any admins about it. Please contact an admin directly.")
+	} else {
+		reply(ctx, "Requested a ratelimit override for `%s`. You'll get a message here when an admin has reviewed it.", bot.MXID)
+	}
+}
+
+func getRatelimitRequestForAdmin(ctx context.Context, username string) (*Bot, *RatelimitRequest) {
+	if !isAdmin(getEvent(ctx).Sender) {
+		reply(ctx, "Only admins can manage ratelimit overrides")
+		return nil, nil
+	}
+	bot := lookupBot(ctx, username)
+	if bot == nil {
+		return nil, nil
+	}
+	req, err := db.GetRatelimitRequest(ctx, bot.MXID)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get pending ratelimit request")
+		return nil, nil
+	}
+	return bot, req
+}
+
+func cmdRatelimitApprove(ctx context.Context, args []string) {
+	if len(args) != 1 && len(args) != 3 {
+		reply(ctx, "**Usage:** `ratelimit approve <username> [<messages per second> <burst count>]`")
+		return
+	}
+	override := &RatelimitOverride{}
+	if len(args) == 3 {
+		var err1, err2 error
+		override.MessagesPerSecond, err1 = strconv.Atoi(args[1])
+		override.BurstCount, err2 = strconv.Atoi(args[2])
+		if err1 != nil || err2 != nil || override.MessagesPerSecond < 0 || override.BurstCount < 0 {
+			reply(ctx, "The messages per second and burst count must be non-negative integers")
+			return
+		}
+	}
+	bot, req := getRatelimitRequestForAdmin(ctx, args[0])
+	if bot == nil {
+		return
+	}
+	setAuditTarget(ctx, AuditRatelimitChanged, bot.MXID)
+	if err := SetRatelimitOverride(ctx, bot.MXID, override); err != nil {
+		replyErr(ctx, err, "Failed to set ratelimit override")
+		return
+	}
+	auditCommand(ctx, AuditRatelimitChanged, bot.MXID, "set to %s", override)
+	reply(ctx, "`%s` now has %s", bot.MXID, override)
+	if req == nil {
+		return
+	} else if err := db.DeleteRatelimitRequest(ctx, bot.MXID); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to delete approved ratelimit request")
+	}
+	if err := notifyUser(ctx, req.RequestedBy, ratelimitApprovedNotice, bot.MXID, getEvent(ctx).Sender, override); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to notify user about approved ratelimit request")
+	}
+}
+
+func cmdRatelimitDeny(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		reply(ctx, "**Usage:** `ratelimit deny <username> [<reason>]`")
+		return
+	}
+	bot, req := getRatelimitRequestForAdmin(ctx, args[0])
+	if bot == nil {
+		return
+	} else if req == nil {
+		reply(ctx, "There's no pending ratelimit request for `%s`", bot.MXID)
+		return
+	}
+	setAuditTarget(ctx, AuditRatelimitChanged, bot.MXID)
+	if err := db.DeleteRatelimitRequest(ctx, bot.MXID); err != nil {
+		replyErr(ctx, err, "Failed to delete ratelimit request")
+		return
+	}
+	auditCommand(ctx, AuditRatelimitChanged, bot.MXID, "denied request from %s", req.RequestedBy)
+	reply(ctx, "Denied ratelimit request for `%s`", bot.MXID)
+	var reason string
+	if len(args) > 1 {
+		reason = "\n\n> " + strings.Join(args[1:], " ")
+	}
+	if err := notifyUser(ctx, req.RequestedBy, ratelimitDeniedNotice, bot.MXID, getEvent(ctx).Sender, reason); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to notify user about denied ratelimit request")
+	}
+}
+
+func cmdRatelimitRemove(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		reply(ctx, "**Usage:** `ratelimit remove <username>`")
+		return
+	}
+	bot, _ := getRatelimitRequestForAdmin(ctx, args[0])
+	if bot == nil {
+		return
+	}
+	setAuditTarget(ctx, AuditRatelimitChanged, bot.MXID)
+	if err := DeleteRatelimitOverride(ctx, bot.MXID); err != nil {
+		replyErr(ctx, err, "Failed to remove ratelimit override")
+	} else {
+		auditCommand(ctx, AuditRatelimitChanged, bot.MXID, "removed override")
+		reply(ctx, "`%s` now has the default ratelimits", bot.MXID)
+	}
+}
@@ -6,8 +6,6 @@ import (
 	"strings"
 
 	"maunium.net/go/mautrix/id"
-	"maunium.net/go/mautrix/synapseadmin"
-	"maunium.net/go/mautrix/util"
 )
 
 const resetConfirm = `Are you sure you want to reset the access token of ´%s´?
@@ -18,17 +16,23 @@ To keep encryption working on the bot, make sure to clear the bot database too.
 Type ´really reset´ to confirm deletion.`
 
 func cmdReset(ctx context.Context, args []string) {
+	args, flags := parseFlags(args)
 	if len(args) < 1 {
-		reply(ctx, "**Usage:** `reset <username>`")
+		reply(ctx, "**Usage:** `reset <username> [--format=env|json|yaml|mautrix-go] [--deliver=message|to-device] [--expire=<duration>|read]`")
 		return
 	}
-	bot := getBotMeta(ctx, args[0])
+	credOpts, ok := getCredentialOptions(ctx, flags)
+	if !ok {
+		return
+	}
+	bot := getBotMeta(ctx, args[0], RoleMaintainer)
 	if bot == nil {
 		return
 	}
 	cmdCtx := getUserCommandContext(ctx)
 	cmdCtx.Next = cmdReallyReset
 	cmdCtx.Data["reset_bot_mxid"] = bot.MXID
+	cmdCtx.Data["reset_credential_options"] = credOpts
 	cmdCtx.Action = fmt.Sprintf("resetting `%s`", bot.MXID)
 	reply(ctx, resetConfirm, bot.MXID)
 }
@@ -36,30 +40,20 @@ func cmdReset(ctx context.Context, args []string) {
 func cmdReallyReset(ctx context.Context, _ []string) {
 	cmdCtx := getUserCommandContext(ctx)
 	userID := cmdCtx.Data["reset_bot_mxid"].(id.UserID)
+	credOpts := cmdCtx.Data["reset_credential_options"].(*CredentialOptions)
 	cmdCtx.Clear()
 	if strings.TrimSpace(getEvent(ctx).Content.AsMessage().Body) != "really reset" {
 		reply(ctx, "Cancelled resetting `%s`", userID)
 		return
 	}
-	bot := getBotMeta(ctx, userID.Localpart())
+	bot := getBotMeta(ctx, userID.Localpart(), RoleMaintainer)
 	if bot == nil {
 		return
 	}
-	password := util.RandomString(72)
-	err := synadm.ResetPassword(ctx, synapseadmin.ReqResetPassword{
-		UserID:        bot.MXID,
-		NewPassword:   password,
-		LogoutDevices: true,
-	})
+	resp, err := resetBot(ctx, bot)
 	if err != nil {
 		replyErr(ctx, err, "Failed to reset bot")
 		return
 	}
-	resp, err := Login(ctx, bot.MXID, password)
-	if err != nil {
-		replyErr(ctx, err, "Failed to create device after resetting bot")
-		return
-	}
-	evtID := reply(ctx, "Bot reset successfully."+botDetails, resp.UserID, resp.DeviceID, resp.AccessToken)
-	selfDestruct(ctx, evtID, botDetailsSelfDestruct)
+	sendBotDetails(ctx, "Bot reset successfully.", resp, credOpts)
 }
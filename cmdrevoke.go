@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/id"
+)
+
+func cmdRevoke(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		cmdRevokeOffered(ctx)
+		return
+	} else if len(args) < 2 {
+		reply(ctx, "**Usage:** `revoke <username> <device ID>`")
+		return
+	}
+	bot := getBotMeta(ctx, args[0], RoleMaintainer)
+	if bot == nil {
+		return
+	}
+	revokeDevice(ctx, bot, id.DeviceID(args[1]))
+}
+
+func revokeDevice(ctx context.Context, bot *Bot, deviceID id.DeviceID) {
+	setAuditTarget(ctx, AuditDeviceRevoked, bot.MXID)
+	err := DeleteDevice(ctx, bot.MXID, deviceID)
+	if errors.Is(err, mautrix.MNotFound) {
+		reply(ctx, "Device `%s` of `%s` doesn't exist", deviceID, bot.MXID)
+	} else if err != nil {
+		replyErr(ctx, err, "Failed to revoke device")
+	} else {
+		if err = db.DeleteBotDevice(ctx, bot.MXID, deviceID); err != nil {
+			replyErr(ctx, err, "Revoked device, but failed to remove it from the database")
+			return
+		}
+		auditCommand(ctx, AuditDeviceRevoked, bot.MXID, "device %s", deviceID)
+		reply(ctx, "Revoked device `%s` of `%s`", deviceID, bot.MXID)
+	}
+}
+
+const revokeOfferTimeout = 15 * time.Minute
+
+type revokeOffer struct {
+	BotMXID   id.UserID
+	DeviceID  id.DeviceID
+	OfferedAt time.Time
+}
+
+var revokeOffers = make(map[id.UserID]*revokeOffer)
+var revokeOffersLock sync.Mutex
+
+func getRevokeOffer(userID id.UserID) *revokeOffer {
+	revokeOffersLock.Lock()
+	defer revokeOffersLock.Unlock()
+	offer, ok := revokeOffers[userID]
+	if ok && time.Since(offer.OfferedAt) > revokeOfferTimeout {
+		delete(revokeOffers, userID)
+		return nil
+	}
+	return offer
+}
+
+func offerRevokeDevice(userID, botMXID id.UserID, deviceID id.DeviceID) {
+	revokeOffersLock.Lock()
+	revokeOffers[userID] = &revokeOffer{BotMXID: botMXID, DeviceID: deviceID, OfferedAt: time.Now()}
+	revokeOffersLock.Unlock()
+}
+
+func cmdRevokeOffered(ctx context.Context) {
+	sender := getEvent(ctx).Sender
+	offer := getRevokeOffer(sender)
+	if offer == nil {
+		reply(ctx, "**Usage:** `revoke <username> <device ID>`")
+		return
+	}
+	revokeOffersLock.Lock()
+	if revokeOffers[sender] == offer {
+		delete(revokeOffers, sender)
+	}
+	revokeOffersLock.Unlock()
+	bot := getBotMeta(ctx, offer.BotMXID.Localpart(), RoleMaintainer)
+	if bot == nil {
+		return
+	}
+	revokeDevice(ctx, bot, offer.DeviceID)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/id"
+)
+
+func cmdRooms(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		reply(ctx, "**Usage:** `rooms <username>`")
+		return
+	}
+	bot := getBotMeta(ctx, args[0], RoleViewer)
+	if bot == nil {
+		return
+	}
+	rooms, err := GetJoinedRooms(ctx, bot.MXID)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get joined rooms")
+		return
+	} else if len(rooms) == 0 {
+		reply(ctx, "`%s` isn't in any rooms", bot.MXID)
+		return
+	}
+	lines := make([]string, len(rooms))
+	for i, roomID := range rooms {
+		lines[i] = formatRoomLine(ctx, roomID)
+	}
+	reply(ctx, "`%s` is in %d rooms:\n\n%s\n\nUse `kick-from %s <room>` to make it leave a room.", bot.MXID, len(rooms), strings.Join(lines, "\n"), bot.MXID.Localpart())
+}
+
+func formatRoomLine(ctx context.Context, roomID id.RoomID) string {
+	info, err := GetRoomInfo(ctx, roomID)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("room_id", roomID.String()).Msg("Failed to get room info")
+		return fmt.Sprintf("* ´%s´ (failed to get details)", roomID)
+	}
+	name := info.Name
+	if name == "" && info.CanonicalAlias != "" {
+		name = info.CanonicalAlias.String()
+	} else if name == "" {
+		name = "Unnamed room"
+	}
+	return fmt.Sprintf("* %s (´%s´, %d members)", name, roomID, info.JoinedMembers)
+}
+
+func resolveRoom(ctx context.Context, room string) (id.RoomID, bool) {
+	if strings.HasPrefix(room, "#") {
+		resp, err := cli.ResolveAlias(id.RoomAlias(room))
+		if err != nil {
+			replyErr(ctx, err, "Failed to resolve room alias")
+			return "", false
+		}
+		return resp.RoomID, true
+	} else if !strings.HasPrefix(room, "!") {
+		reply(ctx, "`%s` is not a room ID or alias", room)
+		return "", false
+	}
+	return id.RoomID(room), true
+}
+
+func cmdKickFrom(ctx context.Context, args []string) {
+	if len(args) < 2 {
+		reply(ctx, "**Usage:** `kick-from <username> <room ID or alias>`")
+		return
+	}
+	bot := getBotMeta(ctx, args[0], RoleMaintainer)
+	if bot == nil {
+		return
+	}
+	setAuditTarget(ctx, AuditBotKicked, bot.MXID)
+	roomID, ok := resolveRoom(ctx, args[1])
+	if !ok {
+		return
+	}
+	rooms, err := GetJoinedRooms(ctx, bot.MXID)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get joined rooms")
+		return
+	}
+	inRoom := false
+	for _, joinedRoomID := range rooms {
+		if joinedRoomID == roomID {
+			inRoom = true
+			break
+		}
+	}
+	if !inRoom {
+		reply(ctx, "`%s` isn't in `%s`", bot.MXID, roomID)
+		return
+	}
+	err = WithTemporarySession(ctx, bot.MXID, func(client *mautrix.Client) error {
+		_, err := client.LeaveRoom(roomID)
+		return err
+	})
+	if err != nil {
+		replyErr(ctx, err, "Failed to make the bot leave the room")
+	} else {
+		auditCommand(ctx, AuditBotKicked, bot.MXID, "left %s", roomID)
+		reply(ctx, "`%s` left `%s`", bot.MXID, roomID)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"maunium.net/go/mautrix/util"
+)
+
+func cmdSelfDestruct(ctx context.Context, args []string) {
+	sender := getEvent(ctx).Sender
+	if len(args) < 1 {
+		opts, ok := getSelfDestructOptions(ctx, "")
+		if ok {
+			reply(ctx, "Messages with credentials will self-destruct %s. Use `self-destruct <duration>|read|default` to change it.", opts)
+		}
+		return
+	}
+	if strings.ToLower(args[0]) == "default" {
+		if err := db.SetUserSelfDestruct(ctx, sender, 0, false); err != nil {
+			replyErr(ctx, err, "Failed to save self-destruct preference")
+		} else {
+			reply(ctx, "Messages with credentials will self-destruct in %s by default", util.FormatDuration(clampSelfDestructDelay(cfg.SelfDestructDelay)))
+		}
+	} else if opts, ok := parseSelfDestructOptions(ctx, args[0]); !ok {
+		return
+	} else if err := db.SetUserSelfDestruct(ctx, sender, opts.Delay, opts.OnRead); err != nil {
+		replyErr(ctx, err, "Failed to save self-destruct preference")
+	} else {
+		reply(ctx, "Messages with credentials will now self-destruct %s", opts)
+	}
+}
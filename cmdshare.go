@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/id"
+)
+
+const botSharedNotice = "%s made you %s of the bot ´%s´. Use ´show %s´ to see its details."
+const botUnsharedNotice = "%s removed your access to the bot ´%s´."
+
+func cmdShare(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		reply(ctx, "**Usage:** `share <username> [<user ID> <owner|maintainer|viewer>]`")
+		return
+	}
+	bot := getOwnedBot(ctx, args[0], RoleOwner)
+	if bot == nil {
+		return
+	} else if len(args) < 3 {
+		listBotMembers(ctx, bot)
+		return
+	}
+	setAuditTarget(ctx, AuditBotShared, bot.MXID)
+	userID := id.UserID(args[1])
+	role := BotRole(strings.ToLower(args[2]))
+	if _, _, err := userID.Parse(); err != nil {
+		reply(ctx, "`%s` is not a valid user ID", args[1])
+		return
+	} else if !role.IsValid() {
+		reply(ctx, "Unknown role `%s`. Valid roles are `owner`, `maintainer` and `viewer`.", args[2])
+		return
+	} else if userID == bot.OwnerMXID {
+		reply(ctx, "%s created the bot, so they'll always be an owner of it", userID)
+		return
+	}
+	if err := db.SetBotRole(ctx, bot.MXID, userID, role); err != nil {
+		replyErr(ctx, err, "Failed to share bot")
+		return
+	}
+	auditCommand(ctx, AuditBotShared, bot.MXID, "%s is now %s", userID, withArticle(role))
+	reply(ctx, "%s is now %s of `%s`", userID, withArticle(role), bot.MXID)
+	err := notifyUser(ctx, userID, botSharedNotice, getEvent(ctx).Sender, withArticle(role), bot.MXID, bot.MXID.Localpart())
+	if err != nil {
+		// Users who haven't talked to botbot yet don't have a management room
+		zerolog.Ctx(ctx).Debug().Err(err).Msg("Failed to notify user about shared bot")
+	}
+}
+
+func listBotMembers(ctx context.Context, bot *Bot) {
+	members, err := db.GetBotMembers(ctx, bot.MXID)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get bot members")
+		return
+	}
+	lines := make([]string, len(members))
+	for i, member := range members {
+		lines[i] = fmt.Sprintf("* %s: %s", member.UserID, member.Role)
+	}
+	reply(ctx, "Users with access to `%s`:\n\n%s", bot.MXID, strings.Join(lines, "\n"))
+}
+
+func cmdUnshare(ctx context.Context, args []string) {
+	if len(args) < 2 {
+		reply(ctx, "**Usage:** `unshare <username> <user ID>`")
+		return
+	}
+	bot := getOwnedBot(ctx, args[0], RoleOwner)
+	if bot == nil {
+		return
+	}
+	setAuditTarget(ctx, AuditBotUnshared, bot.MXID)
+	userID := id.UserID(args[1])
+	if userID == bot.OwnerMXID {
+		reply(ctx, "%s created the bot, so their access can't be removed", userID)
+		return
+	} else if role, err := db.GetBotRole(ctx, bot.MXID, userID); err != nil {
+		replyErr(ctx, err, "Failed to get user's role")
+		return
+	} else if role == RoleNone {
+		reply(ctx, "%s doesn't have access to `%s`", userID, bot.MXID)
+		return
+	} else if err = db.RemoveBotRole(ctx, bot.MXID, userID); err != nil {
+		replyErr(ctx, err, "Failed to unshare bot")
+		return
+	}
+	auditCommand(ctx, AuditBotUnshared, bot.MXID, "removed %s", userID)
+	reply(ctx, "Removed %s's access to `%s`", userID, bot.MXID)
+	if err := notifyUser(ctx, userID, botUnsharedNotice, getEvent(ctx).Sender, bot.MXID); err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Msg("Failed to notify user about unshared bot")
+	}
+}
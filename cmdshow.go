@@ -16,28 +16,63 @@ const showBotMessage = `Bot ´%s´ info:
 * Created on %s
 * Device ID: ´%s´
 * Last seen %s
-`
+%s`
 
-func getBotMeta(ctx context.Context, username string) *Bot {
+func getBotMeta(ctx context.Context, username string, minRole BotRole) *Bot {
+	bot, err := authorizeBot(ctx, getEvent(ctx).Sender, username, minRole, false)
+	if err != nil {
+		replyError(ctx, err, "Failed to check your access to the bot")
+	}
+	return bot
+}
+
+// getOwnedBot is like getBotMeta, but also returns suspended bots.
+func getOwnedBot(ctx context.Context, username string, minRole BotRole) *Bot {
+	bot, err := authorizeBot(ctx, getEvent(ctx).Sender, username, minRole, true)
+	if err != nil {
+		replyError(ctx, err, "Failed to check your access to the bot")
+	}
+	return bot
+}
+
+func withArticle(role BotRole) string {
+	if role == RoleOwner {
+		return "an " + string(role)
+	}
+	return "a " + string(role)
+}
+
+func lookupBot(ctx context.Context, username string) *Bot {
 	bot, err := db.GetBot(ctx, id.NewUserID(strings.ToLower(username), cli.UserID.Homeserver()))
 	if err != nil {
 		replyErr(ctx, err, "Failed to get bot info")
 	} else if bot == nil {
 		reply(ctx, "That bot doesn't exist")
-	} else if bot.OwnerMXID != getEvent(ctx).Sender {
-		reply(ctx, "That's not your bot")
 	} else {
 		return bot
 	}
 	return nil
 }
 
+func formatLastSeen(ts int64) string {
+	lastSeenTS := time.UnixMilli(ts)
+	if ts == 0 {
+		return "never"
+	} else if seenAgo := time.Since(lastSeenTS); seenAgo < time.Second {
+		return "now"
+	} else if seenAgo >= 1*util.Week {
+		return "at " + lastSeenTS.UTC().Format(time.UnixDate)
+	} else {
+		return util.FormatDuration(seenAgo) + " ago"
+	}
+}
+
 func cmdShow(ctx context.Context, args []string) {
 	if len(args) < 1 {
 		reply(ctx, "**Usage:** `show <username>`")
 		return
 	}
-	bot := getBotMeta(ctx, args[0])
+	bot := getOwnedBot(ctx, args[0], RoleViewer)
 	if bot == nil {
 		return
 	}
@@ -59,16 +94,7 @@ func cmdShow(ctx context.Context, args []string) {
 		deviceInfo := devices.Devices[0]
 		deviceID = deviceInfo.DeviceID.String()
 
-		lastSeenTS := time.UnixMilli(deviceInfo.LastSeenTS)
-		if deviceInfo.LastSeenTS == 0 {
-			lastSeen = "never"
-		} else if seenAgo := time.Since(lastSeenTS); seenAgo < time.Second {
-			lastSeen = "now"
-		} else if seenAgo >= 1*util.Week {
-			lastSeen = "at " + lastSeenTS.UTC().Format(time.UnixDate)
-		} else {
-			lastSeen = util.FormatDuration(seenAgo) + " ago"
-		}
+		lastSeen = formatLastSeen(deviceInfo.LastSeenTS)
 		if deviceInfo.LastSeenIP != "" {
 			lastSeen += " from " + deviceInfo.LastSeenIP
 		}
@@ -77,11 +103,30 @@ func cmdShow(ctx context.Context, args []string) {
 		deviceID = "<none>"
 		lastSeen = "N/A"
 	}
+	var extraInfo string
+	if bot.Purpose != "" {
+		extraInfo += "* Purpose: " + bot.Purpose + "\n"
+	}
+	if !bot.ExpiresAt.IsZero() {
+		extraInfo += "* Expires at " + bot.ExpiresAt.UTC().Format(time.UnixDate) + "\n"
+	}
+	if override, err := GetRatelimitOverride(ctx, bot.MXID); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to get ratelimit override")
+	} else if override != nil {
+		extraInfo += "* Ratelimit override: " + override.String() + "\n"
+	}
+	if bot.OwnerRoom != "" {
+		extraInfo += "* Owned by team room " + bot.OwnerRoom.String() + "\n"
+	}
+	if bot.SuspendedBy != "" {
+		extraInfo += "* Suspended by " + bot.SuspendedBy.String() + "\n"
+	}
 	reply(
 		ctx, showBotMessage,
 		userInfo.UserID,
 		userInfo.CreationTS.UTC().Format(time.UnixDate),
 		deviceID,
 		lastSeen,
+		extraInfo,
 	)
 }
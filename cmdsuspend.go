@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/exp/slices"
+	"maunium.net/go/mautrix/id"
+)
+
+const botSuspendedNotice = "Your bot ´%s´ was suspended by %s. Its devices were logged out and it can't log in until it's resumed."
+const botResumedNotice = "Your bot ´%s´ was resumed by %s. Use ´reset %s´ to get new credentials for it."
+
+func isAdmin(userID id.UserID) bool {
+	return slices.Contains(cfg.Admins, userID.String())
+}
+
+func getSuspendableBot(ctx context.Context, username string) *Bot {
+	if !isAdmin(getEvent(ctx).Sender) {
+		return getOwnedBot(ctx, username, RoleMaintainer)
+	}
+	bot := lookupBot(ctx, username)
+	if bot != nil && bot.Deactivated {
+		reply(ctx, "That bot has been deactivated")
+		return nil
+	}
+	return bot
+}
+
+func cmdSuspend(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		reply(ctx, "**Usage:** `suspend <username>`")
+		return
+	}
+	bot := getSuspendableBot(ctx, args[0])
+	if bot == nil {
+		return
+	} else if bot.SuspendedBy != "" {
+		reply(ctx, "`%s` is already suspended", bot.MXID)
+		return
+	}
+	setAuditTarget(ctx, AuditBotSuspended, bot.MXID)
+	sender := getEvent(ctx).Sender
+	if err := suspendBot(ctx, bot, sender); errors.Is(err, errSuspendLogoutFailed) {
+		auditCommand(ctx, AuditBotSuspended, bot.MXID, "logging out devices failed")
+		replyErr(ctx, err, "Suspended bot, but failed to log out its devices")
+	} else if err != nil {
+		replyErr(ctx, err, "Failed to suspend bot")
+		return
+	} else {
+		auditCommand(ctx, AuditBotSuspended, bot.MXID, "")
+		reply(ctx, "Suspended `%s` and logged out all of its devices. Use `resume %s` to allow it to log in again.", bot.MXID, bot.MXID.Localpart())
+	}
+	if bot.OwnerMXID != sender {
+		if err := notifyUser(ctx, bot.OwnerMXID, botSuspendedNotice, bot.MXID, sender); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to notify owner about suspended bot")
+		}
+	}
+}
+
+// errSuspendLogoutFailed is returned by suspendBot if the bot was suspended, but logging out its devices failed.
+var errSuspendLogoutFailed = errors.New("bot was suspended, but logging out its devices failed")
+
+func suspendBot(ctx context.Context, bot *Bot, suspendedBy id.UserID) error {
+	if err := SetUserLocked(ctx, bot.MXID, true); err != nil {
+		return fmt.Errorf("failed to lock bot account: %w", err)
+	} else if err = db.SetBotSuspendedBy(ctx, bot.MXID, suspendedBy); err != nil {
+		return fmt.Errorf("failed to mark bot as suspended: %w", err)
+	}
+	zerolog.Ctx(ctx).Info().
+		Str("bot_mxid", bot.MXID.String()).
+		Str("suspended_by", suspendedBy.String()).
+		Msg("Suspended bot")
+	if err := logoutAllBotDevices(ctx, bot.MXID); err != nil {
+		return fmt.Errorf("%w: %w", errSuspendLogoutFailed, err)
+	}
+	return nil
+}
+
+func logoutAllBotDevices(ctx context.Context, botMXID id.UserID) error {
+	devices, err := synadm.ListDevices(ctx, botMXID)
+	if err != nil {
+		return err
+	} else if len(devices.Devices) == 0 {
+		return nil
+	}
+	deviceIDs := make([]id.DeviceID, len(devices.Devices))
+	for i, device := range devices.Devices {
+		deviceIDs[i] = device.DeviceID
+	}
+	if err = DeleteDevices(ctx, botMXID, deviceIDs); err != nil {
+		return err
+	}
+	for _, deviceID := range deviceIDs {
+		if err = db.DeleteBotDevice(ctx, botMXID, deviceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdResume(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		reply(ctx, "**Usage:** `resume <username>`")
+		return
+	}
+	bot := getSuspendableBot(ctx, args[0])
+	if bot == nil {
+		return
+	} else if bot.SuspendedBy == "" {
+		reply(ctx, "`%s` isn't suspended", bot.MXID)
+		return
+	}
+	setAuditTarget(ctx, AuditBotResumed, bot.MXID)
+	sender := getEvent(ctx).Sender
+	if isAdmin(bot.SuspendedBy) && !isAdmin(sender) {
+		reply(ctx, "`%s` was suspended by an admin, please contact %s to resume it", bot.MXID, bot.SuspendedBy)
+		return
+	}
+	if err := SetUserLocked(ctx, bot.MXID, false); err != nil {
+		replyErr(ctx, err, "Failed to unlock bot account")
+		return
+	} else if err = db.SetBotSuspendedBy(ctx, bot.MXID, ""); err != nil {
+		replyErr(ctx, err, "Unlocked bot account, but failed to mark it as resumed in the database")
+		return
+	}
+	auditCommand(ctx, AuditBotResumed, bot.MXID, "")
+	if bot.OwnerMXID != sender {
+		reply(ctx, "Resumed `%s`", bot.MXID)
+		if err := notifyUser(ctx, bot.OwnerMXID, botResumedNotice, bot.MXID, sender, bot.MXID.Localpart()); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to notify owner about resumed bot")
+		}
+	} else {
+		reply(ctx, "Resumed `%s`. Use `reset %s` to get new credentials for it.", bot.MXID, bot.MXID.Localpart())
+	}
+}
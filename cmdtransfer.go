@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/util"
+)
+
+const botTransferredNotice = "%s transferred the bot ´%s´ to you. Use ´show %s´ to see its details."
+
+func cmdTransfer(ctx context.Context, args []string) {
+	if len(args) < 2 {
+		reply(ctx, "**Usage:** `transfer <username> <user ID or team room>`")
+		return
+	}
+	bot := getBotMeta(ctx, args[0], RoleOwner)
+	if bot == nil {
+		return
+	}
+	setAuditTarget(ctx, AuditBotTransferred, bot.MXID)
+	if strings.HasPrefix(args[1], "@") {
+		transferBotToUser(ctx, bot, id.UserID(args[1]))
+	} else if roomID, ok := resolveRoom(ctx, args[1]); ok {
+		transferBotToTeam(ctx, bot, roomID)
+	}
+}
+
+func transferBotToUser(ctx context.Context, bot *Bot, newOwner id.UserID) {
+	if _, _, err := newOwner.Parse(); err != nil {
+		reply(ctx, "`%s` is not a valid user ID", newOwner)
+		return
+	} else if newOwner.Homeserver() != cli.UserID.Homeserver() {
+		reply(ctx, "Bots can only be transferred to users on %s", cli.UserID.Homeserver())
+		return
+	} else if newOwner == bot.OwnerMXID && bot.OwnerRoom == "" {
+		reply(ctx, "%s already owns `%s`", newOwner, bot.MXID)
+		return
+	}
+	if cfg.MaxBotsPerUser > 0 {
+		botCount, err := db.CountActiveBots(ctx, newOwner)
+		if err != nil {
+			replyErr(ctx, err, "Failed to get bot list of new owner")
+			return
+		} else if botCount >= cfg.MaxBotsPerUser {
+			reply(ctx, "%s has too many bots already", newOwner)
+			return
+		}
+	}
+	if err := db.SetBotOwner(ctx, bot, newOwner); err != nil {
+		replyErr(ctx, err, "Failed to transfer bot")
+		return
+	}
+	auditCommand(ctx, AuditBotTransferred, bot.MXID, "to %s", newOwner)
+	reply(ctx, "Transferred `%s` to %s", bot.MXID, newOwner)
+	if err := notifyUser(ctx, newOwner, botTransferredNotice, getEvent(ctx).Sender, bot.MXID, bot.MXID.Localpart()); err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Msg("Failed to notify new owner about transferred bot")
+	}
+}
+
+func transferBotToTeam(ctx context.Context, bot *Bot, roomID id.RoomID) {
+	evt := getEvent(ctx)
+	if bot.OwnerRoom == roomID {
+		reply(ctx, "`%s` is already owned by that room", bot.MXID)
+		return
+	} else if isManagement, err := db.IsManagementRoom(ctx, roomID); err != nil {
+		replyErr(ctx, err, "Failed to check if the room is a direct chat")
+		return
+	} else if isManagement || roomID == evt.RoomID {
+		reply(ctx, "Bots can't be transferred to direct chats with me")
+		return
+	}
+	var joinedNow, transferred bool
+	if !cli.StateStore.IsInRoom(roomID, cli.UserID) {
+		if _, err := cli.JoinRoomByID(roomID); err != nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Msg("Failed to join team room")
+			expectTeamInvite(roomID, evt.Sender)
+			reply(ctx, "I'm not in `%s`. Invite me to the room within %s and run the command again.", roomID, util.FormatDuration(teamInviteTimeout))
+			return
+		}
+		joinedNow = true
+	}
+	defer func() {
+		// Don't stay in rooms that didn't become team rooms
+		if joinedNow && !transferred {
+			leaveRoom(ctx, roomID, "Transferring a bot to this room failed")
+		}
+	}()
+	if role, err := getTeamRole(roomID, evt.Sender); err != nil {
+		replyErr(ctx, err, "Failed to check your power level in the team room")
+		return
+	} else if !role.AtLeast(RoleMaintainer) {
+		reply(ctx, "You need a power level of at least %d in the team room to transfer bots to it", cfg.TeamMaintainerPowerLevel)
+		return
+	}
+	if cfg.MaxBotsPerTeam > 0 {
+		botCount, err := db.CountActiveTeamBots(ctx, roomID)
+		if err != nil {
+			replyErr(ctx, err, "Failed to get bot list of team")
+			return
+		} else if botCount >= cfg.MaxBotsPerTeam {
+			reply(ctx, "That team has too many bots already")
+			return
+		}
+	}
+	if err := db.SetBotTeamRoom(ctx, bot.MXID, roomID, evt.Sender); err != nil {
+		replyErr(ctx, err, "Failed to transfer bot")
+		return
+	}
+	transferred = true
+	auditCommand(ctx, AuditBotTransferred, bot.MXID, "to team room %s", roomID)
+	reply(
+		ctx, "`%s` is now owned by `%s`. Members with power level %d can manage it, and members with power level %d have full control.",
+		bot.MXID, roomID, cfg.TeamMaintainerPowerLevel, cfg.TeamOwnerPowerLevel,
+	)
+}
@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/maps"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/util"
 )
 
 const helpMessage = `Botbot %s
@@ -17,10 +23,39 @@ const helpMessage = `Botbot %s
 Commands:
 * ´ping´: Pings the bot
 * ´help´: Shows this message
-* ´list´: Show a list of your bots
+* ´list´: Show a list of your bots, including ones shared with you
 * ´show <username>´: Show info about a specific bot
-* ´create <username>´: Register a new bot
-* ´reset <username>´: Reset the access token of a bot
+* ´create <username> [--expires <duration>] [--format=...] [--deliver=...] [--expire=...]´: Register a new bot,
+  optionally one that's deactivated automatically after the given time
+* ´reset <username> [--format=...] [--deliver=...] [--expire=...]´: Reset the access token of a bot
+* ´extend <username> <duration>´: Push back the deactivation of an expiring bot
+* ´revoke <username> <device ID>´: Log out a device of a bot
+* ´share <username> [<user ID> <owner|maintainer|viewer>]´: View or change who has access to a bot
+* ´unshare <username> <user ID>´: Remove a user's access to a bot
+* ´transfer <username> <user ID or team room>´: Give a bot to another user, or make it owned by a team room
+* ´suspend <username>´: Log out all devices of a bot and block it from logging in
+* ´resume <username>´: Allow a suspended bot to log in again
+* ´rooms <username>´: Show the rooms a bot is in
+* ´ratelimit <username> [<justification>]´: View or request a ratelimit override for a bot
+* ´kick-from <username> <room ID or alias>´: Make a bot leave a room
+* ´login <username> --ttl <duration> [--format=...] [--deliver=...] [--expire=...]´: Create a temporary token for a bot that's revoked automatically
+* ´self-destruct [<duration>|read|default]´: View or change how long credential messages stay in the room
+* ´digest [on|off|weekly|daily]´: View or change how often you get a summary of the bots you own or maintain in this room
+* ´history <username> [--before <ID>]´: Show the audit log of a bot you own
+* ´approve [<request ID>]´: List pending bot creation requests or approve one (approvers only)
+* ´deny <request ID> [<reason>]´: Reject a bot creation request (approvers only)
+
+The ´--format=env|json|yaml|mautrix-go´ option sends the credentials as an encrypted config file instead of inline text.
+The ´--deliver=to-device´ option sends the credentials as an encrypted to-device event to the device you're using
+instead of posting them in the room.
+The ´--expire=<duration>|read´ option overrides your self-destruct preference for that command.
+
+Viewers of a shared bot can see its details, maintainers can also manage its credentials and devices,
+and owners can also share and delete it. Bots owned by a team room can be viewed by all members of the room,
+and managed by members with a high enough power level.
+
+Admins can search the audit log of all bots with ´admin audit [--bot=...] [--actor=...] [--action=...]´,
+and export a list of all bots with ´admin export´.
 `
 
 type CommandHandler func(ctx context.Context, args []string)
@@ -33,7 +68,25 @@ var commands = map[string]CommandHandler{
 	"create": cmdCreate,
 	"reset":  cmdReset,
 	"delete": cmdDelete,
+	"login":  cmdLogin,
+	"extend": cmdExtend,
+	"revoke": cmdRevoke,
 	"cancel": cmdCancel,
+	"rooms":  cmdRooms,
+	"digest": cmdDigest,
+	"resume": cmdResume,
+	"share":  cmdShare,
+	"admin":  cmdAdmin,
+	"deny":   cmdDeny,
+
+	"suspend":       cmdSuspend,
+	"unshare":       cmdUnshare,
+	"transfer":      cmdTransfer,
+	"self-destruct": cmdSelfDestruct,
+	"kick-from":     cmdKickFrom,
+	"ratelimit":     cmdRatelimit,
+	"history":       cmdHistory,
+	"approve":       cmdApprove,
 
 	// Aliases
 	"register":   cmdCreate,
@@ -77,6 +130,8 @@ func getUserCommandContext(ctx context.Context) *CommandContext {
 }
 
 func backgroundMarkRead(ctx context.Context, evt *event.Event) {
+	// The command may finish before marking as read does, so don't keep using its context
+	ctx = detachContext(ctx)
 	go func() {
 		err := cli.MarkRead(evt.RoomID, evt.ID)
 		if err != nil {
@@ -87,8 +142,16 @@ func backgroundMarkRead(ctx context.Context, evt *event.Event) {
 
 func handleCommand(ctx context.Context, evt *event.Event) {
 	log := *zerolog.Ctx(ctx)
+	cmdAudit := &commandAudit{}
+	// metricName is the command label for metrics, it's only set once the message is known to be a command
+	var metricName string
 	defer func() {
+		outcome := "success"
+		if cmdAudit.Failed {
+			outcome = "failure"
+		}
 		if r := recover(); r != nil {
+			outcome = "panic"
 			logEvt := log.Error()
 			if err, ok := r.(error); ok {
 				logEvt = logEvt.Err(err)
@@ -96,8 +159,12 @@ func handleCommand(ctx context.Context, evt *event.Event) {
 				logEvt = logEvt.Interface("error", r)
 			}
 			logEvt.Bytes("stack", debug.Stack()).Msg("Panic while processing command")
+			setSpanError(ctx, nil, "panic")
 			reply(ctx, "Internal error processing command.")
 		}
+		if metricName != "" {
+			metricCommands.WithLabelValues(metricName, outcome).Inc()
+		}
 	}()
 
 	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
@@ -120,28 +187,77 @@ func handleCommand(ctx context.Context, evt *event.Event) {
 
 	command := strings.TrimPrefix(strings.ToLower(args[0]), "!")
 	log = log.With().Str("command", command).Logger()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("botbot.command", command))
 
 	cmdCtx := getCommandContextFromMap(evt.Sender)
 	ctx = context.WithValue(ctx, contextKeyCmdContext, cmdCtx)
+	ctx = context.WithValue(ctx, contextKeyCommandAudit, cmdAudit)
 	ctx = log.WithContext(ctx)
 
 	cmdCtx.Lock()
 	defer cmdCtx.Unlock()
 
 	if cmdCtx.Next != nil && command != "cancel" {
+		metricName = "continue"
 		backgroundMarkRead(ctx, evt)
 		cmdCtx.Next(ctx, args)
 	} else if content.MsgType != event.MsgText {
 		log.Debug().Msg("Ignoring non-text non-context command")
 	} else {
+		metricName = "unknown"
+		if _, ok := commands[command]; ok {
+			metricName = command
+		}
 		backgroundMarkRead(ctx, evt)
-		args = args[1:]
-		cmd, ok := commands[command]
-		if !ok {
-			cmd = cmdUnknownCommand
+		runCommand(ctx, args)
+	}
+}
+
+func runCommand(ctx context.Context, args []string) {
+	command := strings.TrimPrefix(strings.ToLower(args[0]), "!")
+	cmd, ok := commands[command]
+	if !ok {
+		cmd = cmdUnknownCommand
+	}
+	cmd(ctx, args[1:])
+}
+
+func parseFlags(args []string) ([]string, map[string]string) {
+	positional := make([]string, 0, len(args))
+	flags := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		name, isFlag := strings.CutPrefix(args[i], "--")
+		if !isFlag || name == "" {
+			positional = append(positional, args[i])
+		} else if name, value, hasValue := strings.Cut(name, "="); hasValue {
+			flags[strings.ToLower(name)] = value
+		} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			flags[strings.ToLower(name)] = args[i+1]
+			i++
+		} else {
+			flags[strings.ToLower(name)] = ""
 		}
-		cmd(ctx, args)
 	}
+	return positional, flags
+}
+
+// parseDuration is like time.ParseDuration, but also supports days and weeks as whole numbers (e.g. `7d`).
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.ToLower(value)
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(value, "d"):
+		unit = util.Day
+	case strings.HasSuffix(value, "w"):
+		unit = util.Week
+	default:
+		return time.ParseDuration(value)
+	}
+	count, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+	}
+	return time.Duration(count) * unit, nil
 }
 
 func cmdUnknownCommand(ctx context.Context, _ []string) {
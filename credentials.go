@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/crypto/attachment"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+const botDetailsFile = `
+
+The credentials for ´%s´ are in the attached ´%s´ file.
+
+The file will self-destruct %s.`
+
+const botDetailsToDevice = `
+
+The credentials for ´%s´ were sent to your device ´%s´ as an encrypted ´%s´ to-device event.`
+
+const pickleKeyPlaceholder = "CHANGE_ME"
+
+// The content of ToDeviceBotCredentials events is a BotCredentials object.
+var ToDeviceBotCredentials = event.Type{Type: "com.beeper.botbot.credentials", Class: event.ToDeviceEventType}
+
+type BotCredentials struct {
+	HomeserverURL string      `json:"homeserver_url"`
+	UserID        id.UserID   `json:"user_id"`
+	DeviceID      id.DeviceID `json:"device_id"`
+	AccessToken   string      `json:"access_token"`
+	PickleKey     string      `json:"pickle_key,omitempty"`
+}
+
+type CredentialFormat struct {
+	Extension string
+	MimeType  string
+	Render    func(creds *BotCredentials) ([]byte, error)
+}
+
+var credentialFormats = map[string]CredentialFormat{
+	"env":        {Extension: "env", MimeType: "text/plain", Render: renderCredentialsEnv},
+	"json":       {Extension: "json", MimeType: "application/json", Render: renderCredentialsJSON},
+	"yaml":       {Extension: "yaml", MimeType: "application/yaml", Render: renderCredentialsYAML},
+	"mautrix-go": {Extension: "go", MimeType: "text/x-go", Render: renderCredentialsMautrixGo},
+}
+
+func renderCredentialsEnv(creds *BotCredentials) ([]byte, error) {
+	return []byte(fmt.Sprintf(`MATRIX_HOMESERVER_URL=%s
+MATRIX_USER_ID=%s
+MATRIX_DEVICE_ID=%s
+MATRIX_ACCESS_TOKEN=%s
+MATRIX_PICKLE_KEY=%s
+`, creds.HomeserverURL, creds.UserID, creds.DeviceID, creds.AccessToken, creds.PickleKey)), nil
+}
+
+func renderCredentialsJSON(creds *BotCredentials) ([]byte, error) {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal credentials: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// renderCredentialsYAML uses Go-quoted strings, which are valid YAML double-quoted scalars for the values we have.
+func renderCredentialsYAML(creds *BotCredentials) ([]byte, error) {
+	return []byte(fmt.Sprintf(`homeserver_url: %q
+user_id: %q
+device_id: %q
+access_token: %q
+pickle_key: %q
+`, creds.HomeserverURL, creds.UserID, creds.DeviceID, creds.AccessToken, creds.PickleKey)), nil
+}
+
+func renderCredentialsMautrixGo(creds *BotCredentials) ([]byte, error) {
+	return []byte(fmt.Sprintf(`package main
+
+import (
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/crypto/cryptohelper"
+	"maunium.net/go/mautrix/id"
+)
+
+const (
+	homeserverURL = %q
+	userID        = id.UserID(%q)
+	deviceID      = id.DeviceID(%q)
+	accessToken   = %q
+	// Replace this with a random secret, it's used to encrypt the crypto database.
+	pickleKey = %q
+)
+
+func newClient() (*mautrix.Client, error) {
+	client, err := mautrix.NewClient(homeserverURL, userID, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	client.DeviceID = deviceID
+	cryptoHelper, err := cryptohelper.NewCryptoHelper(client, []byte(pickleKey), "crypto.db")
+	if err != nil {
+		return nil, err
+	}
+	err = cryptoHelper.Init()
+	if err != nil {
+		return nil, err
+	}
+	client.Crypto = cryptoHelper
+	return client, nil
+}
+`, creds.HomeserverURL, creds.UserID, creds.DeviceID, creds.AccessToken, creds.PickleKey)), nil
+}
+
+type CredentialOptions struct {
+	Format       *CredentialFormat
+	ToDevice     bool
+	SelfDestruct *SelfDestructOptions
+}
+
+func getCredentialOptions(ctx context.Context, flags map[string]string) (*CredentialOptions, bool) {
+	var opts CredentialOptions
+	var ok bool
+	opts.SelfDestruct, ok = getSelfDestructOptions(ctx, flags["expire"])
+	if !ok {
+		return nil, false
+	}
+	if formatName := flags["format"]; formatName != "" {
+		credFormat, ok := credentialFormats[strings.ToLower(formatName)]
+		if !ok {
+			reply(ctx, "Unknown credential format `%s`. Supported formats are `env`, `json`, `yaml` and `mautrix-go`.", formatName)
+			return nil, false
+		}
+		opts.Format = &credFormat
+	}
+	switch strings.ToLower(flags["deliver"]) {
+	case "", "message":
+	case "to-device":
+		if opts.Format != nil {
+			reply(ctx, "The `--format` option can't be combined with `--deliver=to-device`.")
+			return nil, false
+		} else if getEvent(ctx).Mautrix.TrustSource == nil {
+			reply(ctx, "Failed to find the device that sent the command, can't deliver credentials to it.")
+			return nil, false
+		}
+		opts.ToDevice = true
+	default:
+		reply(ctx, "Unknown delivery method `%s`. Supported methods are `message` and `to-device`.", flags["deliver"])
+		return nil, false
+	}
+	return &opts, true
+}
+
+func getHomeserverURLForCredentials() string {
+	if cfg.PublicHomeserverURL != "" {
+		return cfg.PublicHomeserverURL
+	}
+	return cfg.HomeserverURL
+}
+
+func sendBotDetails(ctx context.Context, message string, device *mautrix.RespLogin, opts *CredentialOptions) {
+	if opts.ToDevice {
+		sendBotDetailsToDevice(ctx, message, device)
+	} else if opts.Format != nil {
+		sendBotDetailsFile(ctx, message, device, opts.Format, opts.SelfDestruct)
+	} else {
+		evtID := reply(ctx, message+botDetails, device.UserID, device.DeviceID, device.AccessToken, opts.SelfDestruct)
+		selfDestruct(ctx, evtID, opts.SelfDestruct)
+	}
+}
+
+func sendBotDetailsToDevice(ctx context.Context, message string, device *mautrix.RespLogin) {
+	targetDevice := getEvent(ctx).Mautrix.TrustSource
+	err := cryptoHelper.Machine().SendEncryptedToDevice(ctx, targetDevice, ToDeviceBotCredentials, event.Content{
+		Parsed: &BotCredentials{
+			HomeserverURL: getHomeserverURLForCredentials(),
+			UserID:        device.UserID,
+			DeviceID:      device.DeviceID,
+			AccessToken:   device.AccessToken,
+		},
+	})
+	if err != nil {
+		replyErr(ctx, err, "Failed to send credentials to your device. Use `reset <username>` to try again.")
+		return
+	}
+	reply(ctx, message+botDetailsToDevice, device.UserID, targetDevice.DeviceID, ToDeviceBotCredentials.Type)
+}
+
+func sendBotDetailsFile(ctx context.Context, message string, device *mautrix.RespLogin, credFormat *CredentialFormat, sdOpts *SelfDestructOptions) {
+	data, err := credFormat.Render(&BotCredentials{
+		HomeserverURL: getHomeserverURLForCredentials(),
+		UserID:        device.UserID,
+		DeviceID:      device.DeviceID,
+		AccessToken:   device.AccessToken,
+		PickleKey:     pickleKeyPlaceholder,
+	})
+	if err != nil {
+		replyErr(ctx, err, "Failed to create credential file. Use `reset <username>` to try again.")
+		return
+	}
+	fileName := fmt.Sprintf("%s.%s", device.UserID.Localpart(), credFormat.Extension)
+	file, err := uploadEncryptedFile(data)
+	if err != nil {
+		replyErr(ctx, err, "Failed to upload credential file. Use `reset <username>` to try again.")
+		return
+	}
+	reply(ctx, message+botDetailsFile, device.UserID, fileName, sdOpts)
+	evtID := replyFile(ctx, fileName, credFormat.MimeType, len(data), file)
+	selfDestruct(ctx, evtID, sdOpts)
+}
+
+// uploadEncryptedFile encrypts the data in place and uploads it to the media repo.
+func uploadEncryptedFile(data []byte) (*event.EncryptedFileInfo, error) {
+	file := attachment.NewEncryptedFile()
+	file.EncryptInPlace(data)
+	resp, err := cli.UploadMedia(mautrix.ReqUploadMedia{
+		ContentBytes: data,
+		ContentType:  "application/octet-stream",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event.EncryptedFileInfo{
+		EncryptedFile: *file,
+		URL:           resp.ContentURI.CUString(),
+	}, nil
+}
+
+func replyFile(ctx context.Context, fileName, mimeType string, size int, file *event.EncryptedFileInfo) id.EventID {
+	return replyContent(ctx, ReplyOpts{}, &event.MessageEventContent{
+		MsgType: event.MsgFile,
+		Body:    fileName,
+		Info: &event.FileInfo{
+			MimeType: mimeType,
+			Size:     size,
+		},
+		File: file,
+	})
+}
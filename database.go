@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"maunium.net/go/mautrix/id"
@@ -15,23 +18,75 @@ type Database struct {
 }
 
 type Bot struct {
-	MXID      id.UserID
+	MXID id.UserID
+	// OwnerMXID is the current primary owner of the bot, who gets notifications about it.
 	OwnerMXID id.UserID
+	// ExpiresAt is zero for bots that don't expire automatically.
+	ExpiresAt   time.Time
+	Deactivated bool
+	// InactivityNotifiedAt is set when the owner was told that the bot is inactive, and cleared when it's active again.
+	InactivityNotifiedAt time.Time
+	// DevicesCheckedAt is zero if the device list of the bot hasn't been snapshotted yet.
+	DevicesCheckedAt time.Time
+	SuspendedBy      id.UserID
+	OwnerRoom        id.RoomID
+	Purpose          string
 }
 
 const (
-	registerBot    = "INSERT INTO bots (mxid, owner_mxid) VALUES ($1, $2)"
-	getBotsByOwner = "SELECT mxid, owner_mxid FROM bots WHERE owner_mxid=$1"
-	getBot         = "SELECT mxid, owner_mxid FROM bots WHERE mxid=$1"
+	botColumns               = "mxid, owner_mxid, expires_at, deactivated, inactivity_notified_at, devices_checked_at, suspended_by, owner_room, purpose"
+	registerBot              = "INSERT INTO bots (mxid, owner_mxid, expires_at, purpose) VALUES ($1, $2, $3, $4)"
+	getAllBots               = "SELECT " + botColumns + " FROM bots"
+	getBotsByOwner           = "SELECT " + botColumns + " FROM bots WHERE owner_mxid=$1"
+	getBotsByMember          = "SELECT " + botColumns + " FROM bots WHERE mxid IN (SELECT bot_mxid FROM bot_owners WHERE user_mxid=$1)"
+	getBotsByOwnerRoom       = "SELECT " + botColumns + " FROM bots WHERE owner_room=$1"
+	getActiveBots            = "SELECT " + botColumns + " FROM bots WHERE deactivated=false"
+	getBot                   = "SELECT " + botColumns + " FROM bots WHERE mxid=$1"
+	setBotExpiry             = "UPDATE bots SET expires_at=$2 WHERE mxid=$1"
+	deactivateBot            = "UPDATE bots SET deactivated=true, expires_at=NULL WHERE mxid=$1"
+	setBotInactivityNotified = "UPDATE bots SET inactivity_notified_at=$2 WHERE mxid=$1"
+	setBotDevicesChecked     = "UPDATE bots SET devices_checked_at=$2 WHERE mxid=$1"
+	setBotSuspendedBy        = "UPDATE bots SET suspended_by=$2 WHERE mxid=$1"
+	setBotOwnerRoom          = "UPDATE bots SET owner_room=$2 WHERE mxid=$1"
+	setBotOwner              = "UPDATE bots SET owner_mxid=$2, owner_room=NULL WHERE mxid=$1"
 )
 
-func (db *Database) RegisterBot(ctx context.Context, owner, bot id.UserID) error {
-	_, err := db.ExecContext(ctx, registerBot, bot, owner)
-	return err
+func (bot *Bot) Scan(row dbutil.Scannable) (*Bot, error) {
+	var expiresAt, inactivityNotifiedAt, devicesCheckedAt sql.NullInt64
+	var suspendedBy, ownerRoom, purpose sql.NullString
+	err := row.Scan(
+		&bot.MXID, &bot.OwnerMXID, &expiresAt, &bot.Deactivated, &inactivityNotifiedAt, &devicesCheckedAt,
+		&suspendedBy, &ownerRoom, &purpose,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	bot.ExpiresAt = parseNullableTime(expiresAt)
+	bot.InactivityNotifiedAt = parseNullableTime(inactivityNotifiedAt)
+	bot.DevicesCheckedAt = parseNullableTime(devicesCheckedAt)
+	bot.SuspendedBy = id.UserID(suspendedBy.String)
+	bot.OwnerRoom = id.RoomID(ownerRoom.String)
+	bot.Purpose = purpose.String
+	return bot, nil
 }
 
-func (db *Database) GetBots(ctx context.Context, owner id.UserID) ([]Bot, error) {
-	rows, err := db.QueryContext(ctx, getBotsByOwner, owner)
+func nullableTime(ts time.Time) sql.NullInt64 {
+	if ts.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: ts.UnixMilli(), Valid: true}
+}
+
+func parseNullableTime(ts sql.NullInt64) time.Time {
+	if !ts.Valid {
+		return time.Time{}
+	}
+	return time.UnixMilli(ts.Int64)
+}
+
+func (db *Database) scanBots(rows dbutil.Rows, err error) ([]Bot, error) {
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +94,7 @@ func (db *Database) GetBots(ctx context.Context, owner id.UserID) ([]Bot, error)
 	var bots []Bot
 	for rows.Next() {
 		var bot Bot
-		if err = rows.Scan(&bot.MXID, &bot.OwnerMXID); err != nil {
+		if _, err = bot.Scan(rows); err != nil {
 			return nil, err
 		}
 		bots = append(bots, bot)
@@ -47,56 +102,669 @@ func (db *Database) GetBots(ctx context.Context, owner id.UserID) ([]Bot, error)
 	return bots, rows.Err()
 }
 
+func (db *Database) RegisterBot(ctx context.Context, owner, bot id.UserID, expiresAt time.Time, purpose string) error {
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = txn.ExecContext(ctx, registerBot, bot, owner, nullableTime(expiresAt), sql.NullString{String: purpose, Valid: purpose != ""})
+	if err == nil {
+		_, err = txn.ExecContext(ctx, setBotRole, bot, owner, RoleOwner)
+	}
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
+
+func (db *Database) GetBots(ctx context.Context, owner id.UserID) ([]Bot, error) {
+	return db.scanBots(db.QueryContext(ctx, getBotsByOwner, owner))
+}
+
+func (db *Database) GetSharedBots(ctx context.Context, user id.UserID) ([]Bot, error) {
+	return db.scanBots(db.QueryContext(ctx, getBotsByMember, user))
+}
+
+func (db *Database) GetAllBots(ctx context.Context) ([]Bot, error) {
+	return db.scanBots(db.QueryContext(ctx, getAllBots))
+}
+
+func (db *Database) GetActiveBots(ctx context.Context) ([]Bot, error) {
+	return db.scanBots(db.QueryContext(ctx, getActiveBots))
+}
+
+func (db *Database) GetTeamBots(ctx context.Context, roomID id.RoomID) ([]Bot, error) {
+	return db.scanBots(db.QueryContext(ctx, getBotsByOwnerRoom, roomID))
+}
+
+// Bots owned by a team room count towards the team's quota instead of the owner's.
+func (db *Database) CountActiveBots(ctx context.Context, owner id.UserID) (int, error) {
+	bots, err := db.GetBots(ctx, owner)
+	return countActiveBots(bots, err, true)
+}
+
+func (db *Database) CountActiveTeamBots(ctx context.Context, roomID id.RoomID) (int, error) {
+	bots, err := db.GetTeamBots(ctx, roomID)
+	return countActiveBots(bots, err, false)
+}
+
+func countActiveBots(bots []Bot, err error, excludeTeamBots bool) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, bot := range bots {
+		if !bot.Deactivated && (!excludeTeamBots || bot.OwnerRoom == "") {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func (db *Database) GetBot(ctx context.Context, bot id.UserID) (*Bot, error) {
-	var b Bot
-	err := db.
-		QueryRowContext(ctx, getBot, bot).
-		Scan(&b.MXID, &b.OwnerMXID)
+	return (&Bot{}).Scan(db.QueryRowContext(ctx, getBot, bot))
+}
+
+func (db *Database) SetBotExpiry(ctx context.Context, bot id.UserID, expiresAt time.Time) error {
+	_, err := db.ExecContext(ctx, setBotExpiry, bot, nullableTime(expiresAt))
+	return err
+}
+
+func (db *Database) SetBotInactivityNotified(ctx context.Context, bot id.UserID, notifiedAt time.Time) error {
+	_, err := db.ExecContext(ctx, setBotInactivityNotified, bot, nullableTime(notifiedAt))
+	return err
+}
+
+func (db *Database) SetBotDevicesChecked(ctx context.Context, bot id.UserID, checkedAt time.Time) error {
+	_, err := db.ExecContext(ctx, setBotDevicesChecked, bot, nullableTime(checkedAt))
+	return err
+}
+
+func (db *Database) SetBotTeamRoom(ctx context.Context, bot id.UserID, roomID id.RoomID, addedBy id.UserID) error {
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = txn.ExecContext(ctx, addTeamRoom, roomID, addedBy, time.Now().UnixMilli())
+	if err == nil {
+		_, err = txn.ExecContext(ctx, setBotOwnerRoom, bot, roomID)
+	}
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
+
+// The previous owner loses their access to the bot, the bot is removed from its team room if it had one,
+// and other shared access is kept.
+func (db *Database) SetBotOwner(ctx context.Context, bot *Bot, newOwner id.UserID) error {
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = txn.ExecContext(ctx, setBotOwner, bot.MXID, newOwner)
+	if err == nil {
+		_, err = txn.ExecContext(ctx, removeBotRole, bot.MXID, bot.OwnerMXID)
+	}
+	if err == nil {
+		_, err = txn.ExecContext(ctx, setBotRole, bot.MXID, newOwner, RoleOwner)
+	}
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
+
+func (db *Database) SetBotSuspendedBy(ctx context.Context, bot, suspendedBy id.UserID) error {
+	var suspendedByStr sql.NullString
+	if suspendedBy != "" {
+		suspendedByStr = sql.NullString{String: suspendedBy.String(), Valid: true}
+	}
+	_, err := db.ExecContext(ctx, setBotSuspendedBy, bot, suspendedByStr)
+	return err
+}
+
+func (db *Database) MarkBotDeactivated(ctx context.Context, bot id.UserID) error {
+	_, err := db.ExecContext(ctx, deactivateBot, bot)
+	return err
+}
+
+// Each role can do everything the previous ones can.
+type BotRole string
+
+const (
+	RoleNone       BotRole = ""
+	RoleViewer     BotRole = "viewer"
+	RoleMaintainer BotRole = "maintainer"
+	RoleOwner      BotRole = "owner"
+)
+
+var roleLevels = map[BotRole]int{
+	RoleViewer:     1,
+	RoleMaintainer: 2,
+	RoleOwner:      3,
+}
+
+func (role BotRole) IsValid() bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+func (role BotRole) AtLeast(other BotRole) bool {
+	return roleLevels[role] >= roleLevels[other]
+}
+
+type BotMember struct {
+	UserID id.UserID
+	Role   BotRole
+}
+
+const (
+	setBotRole = `
+		INSERT INTO bot_owners (bot_mxid, user_mxid, role) VALUES ($1, $2, $3)
+		ON CONFLICT (bot_mxid, user_mxid) DO UPDATE SET role=excluded.role
+	`
+	getBotRole    = "SELECT role FROM bot_owners WHERE bot_mxid=$1 AND user_mxid=$2"
+	getBotMembers = "SELECT user_mxid, role FROM bot_owners WHERE bot_mxid=$1"
+	removeBotRole = "DELETE FROM bot_owners WHERE bot_mxid=$1 AND user_mxid=$2"
+)
+
+func (db *Database) SetBotRole(ctx context.Context, bot, user id.UserID, role BotRole) error {
+	_, err := db.ExecContext(ctx, setBotRole, bot, user, role)
+	return err
+}
+
+func (db *Database) GetBotRole(ctx context.Context, bot, user id.UserID) (role BotRole, err error) {
+	err = db.QueryRowContext(ctx, getBotRole, bot, user).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return
+}
+
+func (db *Database) GetBotMembers(ctx context.Context, bot id.UserID) ([]BotMember, error) {
+	rows, err := db.QueryContext(ctx, getBotMembers, bot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []BotMember
+	for rows.Next() {
+		var member BotMember
+		if err = rows.Scan(&member.UserID, &member.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (db *Database) RemoveBotRole(ctx context.Context, bot, user id.UserID) error {
+	_, err := db.ExecContext(ctx, removeBotRole, bot, user)
+	return err
+}
+
+const (
+	addTeamRoom = `
+		INSERT INTO team_rooms (room_id, added_by, added_at) VALUES ($1, $2, $3)
+		ON CONFLICT (room_id) DO NOTHING
+	`
+	isTeamRoom   = "SELECT EXISTS(SELECT 1 FROM team_rooms WHERE room_id=$1)"
+	getTeamRooms = "SELECT room_id FROM team_rooms"
+)
+
+func (db *Database) IsTeamRoom(ctx context.Context, roomID id.RoomID) (isTeam bool, err error) {
+	err = db.QueryRowContext(ctx, isTeamRoom, roomID).Scan(&isTeam)
+	return
+}
+
+func (db *Database) GetTeamRooms(ctx context.Context) ([]id.RoomID, error) {
+	rows, err := db.QueryContext(ctx, getTeamRooms)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rooms []id.RoomID
+	for rows.Next() {
+		var roomID id.RoomID
+		if err = rows.Scan(&roomID); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, roomID)
+	}
+	return rooms, rows.Err()
+}
+
+type BotDevice struct {
+	BotMXID         id.UserID
+	DeviceID        id.DeviceID
+	CreatedByBotbot bool
+	// Baseline is true for devices that already existed when botbot first checked the devices of the bot,
+	// which means it's unknown whether they were created through botbot.
+	Baseline  bool
+	FirstSeen time.Time
+}
+
+const (
+	addBotDevice = `
+		INSERT INTO bot_devices (bot_mxid, device_id, created_by_botbot, baseline, first_seen) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (bot_mxid, device_id) DO NOTHING
+	`
+	getBotDevices   = "SELECT bot_mxid, device_id, created_by_botbot, baseline, first_seen FROM bot_devices WHERE bot_mxid=$1"
+	deleteBotDevice = "DELETE FROM bot_devices WHERE bot_mxid=$1 AND device_id=$2"
+)
+
+func (db *Database) AddBotDevice(ctx context.Context, device *BotDevice) error {
+	_, err := db.ExecContext(ctx, addBotDevice, device.BotMXID, device.DeviceID, device.CreatedByBotbot, device.Baseline, device.FirstSeen.UnixMilli())
+	return err
+}
+
+func (db *Database) GetBotDevices(ctx context.Context, bot id.UserID) (map[id.DeviceID]*BotDevice, error) {
+	rows, err := db.QueryContext(ctx, getBotDevices, bot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	devices := make(map[id.DeviceID]*BotDevice)
+	for rows.Next() {
+		var device BotDevice
+		var firstSeen int64
+		if err = rows.Scan(&device.BotMXID, &device.DeviceID, &device.CreatedByBotbot, &device.Baseline, &firstSeen); err != nil {
+			return nil, err
+		}
+		device.FirstSeen = time.UnixMilli(firstSeen)
+		devices[device.DeviceID] = &device
+	}
+	return devices, rows.Err()
+}
+
+func (db *Database) DeleteBotDevice(ctx context.Context, bot id.UserID, deviceID id.DeviceID) error {
+	_, err := db.ExecContext(ctx, deleteBotDevice, bot, deviceID)
+	return err
+}
+
+type RatelimitRequest struct {
+	BotMXID       id.UserID
+	RequestedBy   id.UserID
+	Justification string
+	RequestedAt   time.Time
+}
+
+const (
+	upsertRatelimitRequest = `
+		INSERT INTO ratelimit_requests (bot_mxid, requested_by, justification, requested_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (bot_mxid) DO UPDATE
+			SET requested_by=excluded.requested_by, justification=excluded.justification, requested_at=excluded.requested_at
+	`
+	getRatelimitRequest    = "SELECT bot_mxid, requested_by, justification, requested_at FROM ratelimit_requests WHERE bot_mxid=$1"
+	deleteRatelimitRequest = "DELETE FROM ratelimit_requests WHERE bot_mxid=$1"
+)
+
+func (db *Database) UpsertRatelimitRequest(ctx context.Context, req *RatelimitRequest) error {
+	_, err := db.ExecContext(ctx, upsertRatelimitRequest, req.BotMXID, req.RequestedBy, req.Justification, req.RequestedAt.UnixMilli())
+	return err
+}
+
+func (db *Database) GetRatelimitRequest(ctx context.Context, bot id.UserID) (*RatelimitRequest, error) {
+	var req RatelimitRequest
+	var requestedAt int64
+	err := db.QueryRowContext(ctx, getRatelimitRequest, bot).
+		Scan(&req.BotMXID, &req.RequestedBy, &req.Justification, &requestedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	} else if err != nil {
 		return nil, err
 	}
-	return &b, err
+	req.RequestedAt = time.UnixMilli(requestedAt)
+	return &req, nil
+}
+
+func (db *Database) DeleteRatelimitRequest(ctx context.Context, bot id.UserID) error {
+	_, err := db.ExecContext(ctx, deleteRatelimitRequest, bot)
+	return err
+}
+
+type Job struct {
+	Key       string
+	Action    JobAction
+	Payload   json.RawMessage
+	RunAt     time.Time
+	Attempts  int
+	LastError string
+	RequestID string
+	RoomID    id.RoomID
 }
 
 const (
-	setSelfDestruct    = "INSERT INTO self_destructing_events (event_id, room_id, delete_at) VALUES ($1, $2, $3)"
-	getSelfDestruct    = "SELECT event_id, room_id, delete_at FROM self_destructing_events"
-	deleteSelfDestruct = "DELETE FROM self_destructing_events WHERE event_id=$1"
+	upsertJob = `
+		INSERT INTO scheduled_jobs (job_key, action, payload, run_at, attempts, last_error, request_id, room_id)
+		VALUES ($1, $2, $3, $4, 0, NULL, $5, $6)
+		ON CONFLICT (job_key) DO UPDATE
+			SET action=excluded.action, payload=excluded.payload, run_at=excluded.run_at, attempts=0, last_error=NULL,
+			    request_id=excluded.request_id, room_id=excluded.room_id
+	`
+	getJobs        = "SELECT job_key, action, payload, run_at, attempts, last_error, request_id, room_id FROM scheduled_jobs"
+	getPendingJobs = getJobs + " WHERE attempts<$1"
+	getRoomJobs    = getJobs + " WHERE room_id=$1 AND action=$2"
+	getJob         = getJobs + " WHERE job_key=$1"
+	countJobs      = "SELECT COUNT(*) FROM scheduled_jobs WHERE action=$1"
+	deleteJob      = "DELETE FROM scheduled_jobs WHERE job_key=$1"
+	// Only delete the job if it wasn't rescheduled while it was running
+	finishJob   = "DELETE FROM scheduled_jobs WHERE job_key=$1 AND run_at=$2"
+	setJobRetry = "UPDATE scheduled_jobs SET run_at=$3, attempts=$4, last_error=$5 WHERE job_key=$1 AND run_at=$2"
 )
 
-func (db *Database) SetSelfDestruct(ctx context.Context, roomID id.RoomID, eventID id.EventID, deleteAt time.Time) error {
-	_, err := db.ExecContext(ctx, setSelfDestruct, eventID, roomID, deleteAt.UnixMilli())
+func (job *Job) Scan(row dbutil.Scannable) (*Job, error) {
+	var runAt int64
+	var payload string
+	var lastError, requestID, roomID sql.NullString
+	err := row.Scan(&job.Key, &job.Action, &payload, &runAt, &job.Attempts, &lastError, &requestID, &roomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	job.Payload = json.RawMessage(payload)
+	job.RunAt = time.UnixMilli(runAt)
+	job.LastError = lastError.String
+	job.RequestID = requestID.String
+	job.RoomID = id.RoomID(roomID.String)
+	return job, nil
+}
+
+func (db *Database) scanJobs(rows dbutil.Rows, err error) ([]*Job, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []*Job
+	for rows.Next() {
+		var job Job
+		if _, err = job.Scan(rows); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
+
+func (db *Database) UpsertJob(ctx context.Context, job *Job) error {
+	_, err := db.ExecContext(
+		ctx, upsertJob, job.Key, job.Action, string(job.Payload), job.RunAt.UnixMilli(),
+		sql.NullString{String: job.RequestID, Valid: job.RequestID != ""},
+		sql.NullString{String: job.RoomID.String(), Valid: job.RoomID != ""},
+	)
+	return err
+}
+
+func (db *Database) GetPendingJobs(ctx context.Context, maxAttempts int) ([]*Job, error) {
+	return db.scanJobs(db.QueryContext(ctx, getPendingJobs, maxAttempts))
+}
+
+func (db *Database) GetRoomJobs(ctx context.Context, roomID id.RoomID, action JobAction) ([]*Job, error) {
+	return db.scanJobs(db.QueryContext(ctx, getRoomJobs, roomID, action))
+}
+
+func (db *Database) CountJobsByAction(ctx context.Context, action JobAction) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, countJobs, action).Scan(&count)
+	return count, err
+}
+
+func (db *Database) GetJob(ctx context.Context, key string) (*Job, error) {
+	return (&Job{}).Scan(db.QueryRowContext(ctx, getJob, key))
+}
+
+func (db *Database) DeleteJob(ctx context.Context, key string) error {
+	_, err := db.ExecContext(ctx, deleteJob, key)
 	return err
 }
 
-type SelfDestructingEvent struct {
-	EventID  id.EventID
-	RoomID   id.RoomID
-	DeleteAt time.Time
+func (db *Database) FinishJob(ctx context.Context, job *Job) error {
+	_, err := db.ExecContext(ctx, finishJob, job.Key, job.RunAt.UnixMilli())
+	return err
 }
 
-func (db *Database) GetSelfDestructingEvents(ctx context.Context) ([]SelfDestructingEvent, error) {
-	rows, err := db.QueryContext(ctx, getSelfDestruct)
+// The returned bool is false if the job was changed or deleted while it was running.
+func (db *Database) SetJobRetry(ctx context.Context, job *Job, retryAt time.Time) (bool, error) {
+	res, err := db.ExecContext(ctx, setJobRetry, job.Key, job.RunAt.UnixMilli(), retryAt.UnixMilli(), job.Attempts, job.LastError)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+type User struct {
+	MXID id.UserID
+	// SelfDestructDelay is zero if the user hasn't set a preference.
+	SelfDestructDelay  time.Duration
+	SelfDestructOnRead bool
+	// ManagementRoom is the direct chat where the user last sent a command.
+	ManagementRoom id.RoomID
+	DigestInterval DigestInterval
+}
+
+const (
+	getUser           = "SELECT mxid, self_destruct_delay, self_destruct_on_read, management_room, digest_interval FROM users WHERE mxid=$1"
+	setDigestInterval = `
+		INSERT INTO users (mxid, digest_interval) VALUES ($1, $2)
+		ON CONFLICT (mxid) DO UPDATE SET digest_interval=excluded.digest_interval
+	`
+	isManagementRoom  = "SELECT EXISTS(SELECT 1 FROM users WHERE management_room=$1)"
+	setManagementRoom = `
+		INSERT INTO users (mxid, management_room) VALUES ($1, $2)
+		ON CONFLICT (mxid) DO UPDATE SET management_room=excluded.management_room
+	`
+	setUserSelfDestruct = `
+		INSERT INTO users (mxid, self_destruct_delay, self_destruct_on_read) VALUES ($1, $2, $3)
+		ON CONFLICT (mxid) DO UPDATE SET self_destruct_delay=excluded.self_destruct_delay, self_destruct_on_read=excluded.self_destruct_on_read
+	`
+)
+
+func (db *Database) GetUser(ctx context.Context, userID id.UserID) (*User, error) {
+	u := User{MXID: userID}
+	var delay sql.NullInt64
+	var managementRoom sql.NullString
+	err := db.
+		QueryRowContext(ctx, getUser, userID).
+		Scan(&u.MXID, &delay, &u.SelfDestructOnRead, &managementRoom, &u.DigestInterval)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	u.SelfDestructDelay = time.Duration(delay.Int64) * time.Millisecond
+	u.ManagementRoom = id.RoomID(managementRoom.String)
+	return &u, nil
+}
+
+func (db *Database) SetUserSelfDestruct(ctx context.Context, userID id.UserID, delay time.Duration, onRead bool) error {
+	var delayMS sql.NullInt64
+	if delay > 0 {
+		delayMS = sql.NullInt64{Int64: delay.Milliseconds(), Valid: true}
+	}
+	_, err := db.ExecContext(ctx, setUserSelfDestruct, userID, delayMS, onRead)
+	return err
+}
+
+func (db *Database) SetManagementRoom(ctx context.Context, userID id.UserID, roomID id.RoomID) error {
+	_, err := db.ExecContext(ctx, setManagementRoom, userID, roomID)
+	return err
+}
+
+func (db *Database) IsManagementRoom(ctx context.Context, roomID id.RoomID) (isManagement bool, err error) {
+	err = db.QueryRowContext(ctx, isManagementRoom, roomID).Scan(&isManagement)
+	return
+}
+
+func (db *Database) SetDigestInterval(ctx context.Context, userID id.UserID, interval DigestInterval) error {
+	_, err := db.ExecContext(ctx, setDigestInterval, userID, interval)
+	return err
+}
+
+type AuditFilter struct {
+	Bot    id.UserID
+	Actor  id.UserID
+	Action AuditAction
+	// Before is the ID of the oldest entry on the previous page, or zero to get the newest entries.
+	Before int64
+	Limit  int
+}
+
+const (
+	insertAuditLog = `
+		INSERT INTO audit_log (timestamp, actor, action, bot_mxid, room_id, details, result, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	getAuditLog = "SELECT id, timestamp, actor, action, bot_mxid, room_id, details, error FROM audit_log"
+)
+
+func (db *Database) InsertAuditLog(ctx context.Context, entry *AuditEntry) error {
+	result := "success"
+	var errorStr sql.NullString
+	if entry.Error != "" {
+		result = "failure"
+		errorStr = sql.NullString{String: entry.Error, Valid: true}
+	}
+	return db.QueryRowContext(
+		ctx, insertAuditLog,
+		entry.Timestamp, entry.Actor, entry.Action, sql.NullString{String: entry.Bot.String(), Valid: entry.Bot != ""},
+		sql.NullString{String: entry.RoomID.String(), Valid: entry.RoomID != ""}, entry.Details, result, errorStr,
+	).Scan(&entry.ID)
+}
+
+func (db *Database) GetAuditLog(ctx context.Context, filter *AuditFilter) ([]*AuditEntry, error) {
+	var conditions []string
+	var args []any
+	addCondition := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Bot != "" {
+		addCondition("bot_mxid=$%d", filter.Bot)
+	}
+	if filter.Actor != "" {
+		addCondition("actor=$%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		addCondition("action=$%d", filter.Action)
+	}
+	if filter.Before > 0 {
+		addCondition("id<$%d", filter.Before)
+	}
+	query := getAuditLog
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []*AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var bot, roomID, errorStr sql.NullString
+		err = rows.Scan(&entry.ID, &entry.Timestamp, &entry.Actor, &entry.Action, &bot, &roomID, &entry.Details, &errorStr)
+		if err != nil {
+			return nil, err
+		}
+		entry.Bot = id.UserID(bot.String)
+		entry.RoomID = id.RoomID(roomID.String)
+		entry.Error = errorStr.String
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+type CreateRequest struct {
+	ID          int64
+	RequestedBy id.UserID
+	Username    string
+	Lifetime    time.Duration
+	Purpose     string
+	Flags       map[string]string
+	RoomID      id.RoomID
+	EventID     id.EventID
+	DeviceID    id.DeviceID
+	RequestedAt time.Time
+}
+
+const (
+	insertCreateRequest = `
+		INSERT INTO create_requests (requested_by, username, lifetime, purpose, flags, room_id, event_id, device_id, requested_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	getCreateRequests = `
+		SELECT id, requested_by, username, lifetime, purpose, flags, room_id, event_id, device_id, requested_at
+		FROM create_requests
+	`
+	getAllCreateRequests       = getCreateRequests + " ORDER BY id"
+	getCreateRequest           = getCreateRequests + " WHERE id=$1"
+	getCreateRequestByUsername = getCreateRequests + " WHERE username=$1"
+	deleteCreateRequest        = "DELETE FROM create_requests WHERE id=$1"
+)
+
+func (db *Database) InsertCreateRequest(ctx context.Context, req *CreateRequest) error {
+	flags, err := json.Marshal(req.Flags)
+	if err != nil {
+		return fmt.Errorf("failed to marshal flags: %w", err)
+	}
+	return db.QueryRowContext(
+		ctx, insertCreateRequest,
+		req.RequestedBy, req.Username, req.Lifetime.Milliseconds(), req.Purpose, string(flags), req.RoomID, req.EventID, req.DeviceID,
+		req.RequestedAt.UnixMilli(),
+	).Scan(&req.ID)
+}
+
+func (req *CreateRequest) Scan(row dbutil.Scannable) (*CreateRequest, error) {
+	var lifetime, requestedAt int64
+	var flags []byte
+	err := row.Scan(&req.ID, &req.RequestedBy, &req.Username, &lifetime, &req.Purpose, &flags, &req.RoomID, &req.EventID, &req.DeviceID, &requestedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(flags, &req.Flags); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal flags: %w", err)
+	}
+	req.Lifetime = time.Duration(lifetime) * time.Millisecond
+	req.RequestedAt = time.UnixMilli(requestedAt)
+	return req, nil
+}
+
+func (db *Database) GetCreateRequests(ctx context.Context) ([]*CreateRequest, error) {
+	rows, err := db.QueryContext(ctx, getAllCreateRequests)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var events []SelfDestructingEvent
+	var requests []*CreateRequest
 	for rows.Next() {
-		var evt SelfDestructingEvent
-		var deleteTs int64
-		if err = rows.Scan(&evt.EventID, &evt.RoomID, &deleteTs); err != nil {
+		req, err := (&CreateRequest{}).Scan(rows)
+		if err != nil {
 			return nil, err
 		}
-		evt.DeleteAt = time.UnixMilli(deleteTs)
-		events = append(events, evt)
+		requests = append(requests, req)
 	}
-	return events, rows.Err()
+	return requests, rows.Err()
+}
+
+func (db *Database) GetCreateRequest(ctx context.Context, requestID int64) (*CreateRequest, error) {
+	return (&CreateRequest{}).Scan(db.QueryRowContext(ctx, getCreateRequest, requestID))
+}
+
+func (db *Database) GetCreateRequestByUsername(ctx context.Context, username string) (*CreateRequest, error) {
+	return (&CreateRequest{}).Scan(db.QueryRowContext(ctx, getCreateRequestByUsername, username))
 }
 
-func (db *Database) DoneSelfDestruct(ctx context.Context, eventID id.EventID) error {
-	_, err := db.ExecContext(ctx, deleteSelfDestruct, eventID)
+func (db *Database) DeleteCreateRequest(ctx context.Context, requestID int64) error {
+	_, err := db.ExecContext(ctx, deleteCreateRequest, requestID)
 	return err
 }
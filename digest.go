@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/util"
+)
+
+// An empty DigestInterval means digests are disabled.
+type DigestInterval string
+
+const (
+	DigestDisabled DigestInterval = ""
+	DigestDaily    DigestInterval = "daily"
+	DigestWeekly   DigestInterval = "weekly"
+)
+
+func (di DigestInterval) Duration() time.Duration {
+	switch di {
+	case DigestDaily:
+		return util.Day
+	case DigestWeekly:
+		return util.Week
+	default:
+		return 0
+	}
+}
+
+type DigestPayload struct {
+	UserID id.UserID `json:"user_id"`
+}
+
+func digestJobKey(userID id.UserID) string {
+	return fmt.Sprintf("%s:%s", JobActionDigest, userID)
+}
+
+func updateDigestPreference(ctx context.Context, userID id.UserID, interval DigestInterval) error {
+	err := db.SetDigestInterval(ctx, userID, interval)
+	if err != nil {
+		return fmt.Errorf("failed to save digest preference: %w", err)
+	}
+	if interval == DigestDisabled {
+		return cancelJob(ctx, digestJobKey(userID))
+	}
+	return scheduleJob(ctx, digestJobKey(userID), JobActionDigest, &DigestPayload{UserID: userID}, time.Now().Add(interval.Duration()))
+}
+
+func runDigestJob(ctx context.Context, job *Job) error {
+	var payload DigestPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+	user, err := db.GetUser(ctx, payload.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	} else if user.DigestInterval == DigestDisabled {
+		zerolog.Ctx(ctx).Debug().Msg("User has disabled digests, ignoring job")
+		return nil
+	}
+	digest, err := buildDigest(ctx, user.MXID)
+	if err != nil {
+		return err
+	} else if digest != "" {
+		if err = notifyUser(ctx, user.MXID, digest); err != nil {
+			return fmt.Errorf("failed to send digest: %w", err)
+		}
+	}
+	err = scheduleJob(ctx, job.Key, JobActionDigest, &payload, time.Now().Add(user.DigestInterval.Duration()))
+	if err != nil {
+		return fmt.Errorf("failed to schedule next digest: %w", err)
+	}
+	return nil
+}
+
+// Only bots the user maintains are included, viewers can't act on anything the digest points out.
+// Errors fetching the details of a single bot are included in the digest rather than failing the whole thing.
+func buildDigest(ctx context.Context, userID id.UserID) (string, error) {
+	bots, err := getVisibleBots(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for i := range bots {
+		role, err := getUserBotRole(ctx, &bots[i], userID)
+		if err != nil {
+			return "", fmt.Errorf("failed to check role in %s: %w", bots[i].MXID, err)
+		} else if role.AtLeast(RoleMaintainer) {
+			lines = append(lines, digestBotLine(ctx, &bots[i]))
+		}
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return "Digest of your bots:\n\n" + strings.Join(lines, "\n"), nil
+}
+
+func digestBotLine(ctx context.Context, bot *Bot) string {
+	line := fmt.Sprintf("* [%s](%s)", bot.MXID, bot.MXID.URI().MatrixToURL())
+	if bot.Deactivated {
+		return line + ": deactivated"
+	} else if bot.SuspendedBy != "" {
+		return line + ": suspended"
+	}
+	log := zerolog.Ctx(ctx).With().Str("bot_mxid", bot.MXID.String()).Logger()
+	devices, err := synadm.ListDevices(ctx, bot.MXID)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list devices for digest")
+		return line + ": failed to get devices"
+	}
+	var lastSeenTS int64
+	for _, device := range devices.Devices {
+		if device.LastSeenTS > lastSeenTS {
+			lastSeenTS = device.LastSeenTS
+		}
+	}
+	rooms := "unknown number of"
+	joinedRooms, err := GetJoinedRooms(ctx, bot.MXID)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get joined rooms for digest")
+	} else {
+		rooms = fmt.Sprintf("%d", len(joinedRooms))
+	}
+	line += fmt.Sprintf(": last seen %s, %d devices, %s rooms", formatLastSeen(lastSeenTS), len(devices.Devices), rooms)
+	var flags []string
+	if !bot.InactivityNotifiedAt.IsZero() {
+		flags = append(flags, "inactive")
+	}
+	if !bot.ExpiresAt.IsZero() {
+		flags = append(flags, "expires at "+bot.ExpiresAt.UTC().Format(time.UnixDate))
+	}
+	knownDevices, err := db.GetBotDevices(ctx, bot.MXID)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get known devices for digest")
+	} else {
+		for _, device := range knownDevices {
+			if !device.CreatedByBotbot && !device.Baseline {
+				flags = append(flags, "has devices not created through botbot")
+				break
+			}
+		}
+	}
+	if len(flags) > 0 {
+		line += " (" + strings.Join(flags, ", ") + ")"
+	}
+	return line
+}
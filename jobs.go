@@ -0,0 +1,262 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"maunium.net/go/mautrix/id"
+)
+
+type JobAction string
+
+const (
+	JobActionRedactEvent      JobAction = "redact_event"
+	JobActionExpireDevice     JobAction = "expire_device"
+	JobActionExpireBot        JobAction = "expire_bot"
+	JobActionBotExpiryWarning JobAction = "bot_expiry_warning"
+	JobActionReconcile        JobAction = "reconcile"
+	JobActionDigest           JobAction = "digest"
+)
+
+type JobHandler func(ctx context.Context, job *Job) error
+
+var jobHandlers = map[JobAction]JobHandler{
+	JobActionRedactEvent:      runRedactEventJob,
+	JobActionExpireDevice:     runExpireDeviceJob,
+	JobActionExpireBot:        runExpireBotJob,
+	JobActionBotExpiryWarning: runBotExpiryWarningJob,
+	JobActionReconcile:        runReconcileJob,
+	JobActionDigest:           runDigestJob,
+}
+
+const (
+	jobMaxAttempts  = 10
+	jobRetryBackoff = 10 * time.Second
+	jobMaxBackoff   = 1 * time.Hour
+)
+
+// jobQueue is a min-heap of jobs ordered by the time they should run.
+type jobQueue []*Job
+
+func (q jobQueue) Len() int           { return len(q) }
+func (q jobQueue) Less(i, j int) bool { return q[i].RunAt.Before(q[j].RunAt) }
+func (q jobQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *jobQueue) Push(x any)        { *q = append(*q, x.(*Job)) }
+func (q *jobQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return item
+}
+
+// The scheduled_jobs table is the source of truth, the in-memory heap only decides what to do next.
+type JobScheduler struct {
+	lock    sync.Mutex
+	queue   jobQueue
+	wakeup  chan struct{}
+	running sync.WaitGroup
+}
+
+var jobScheduler = &JobScheduler{
+	wakeup: make(chan struct{}, 1),
+}
+
+// If a job with the same key exists, scheduleJob replaces it.
+func scheduleJob(ctx context.Context, key string, action JobAction, payload any, runAt time.Time) error {
+	return scheduleRoomJob(ctx, key, action, "", payload, runAt)
+}
+
+func scheduleRoomJob(ctx context.Context, key string, action JobAction, roomID id.RoomID, payload any, runAt time.Time) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job payload: %w", err)
+	}
+	job := &Job{
+		Key:       key,
+		Action:    action,
+		Payload:   payloadJSON,
+		RunAt:     runAt,
+		RequestID: getRequestID(ctx),
+		RoomID:    roomID,
+	}
+	err = db.UpsertJob(ctx, job)
+	if err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	jobScheduler.push(job)
+	return nil
+}
+
+func cancelJob(ctx context.Context, key string) error {
+	jobScheduler.remove(key)
+	return db.DeleteJob(ctx, key)
+}
+
+func (js *JobScheduler) push(job *Job) {
+	js.lock.Lock()
+	js.removeUnlocked(job.Key)
+	heap.Push(&js.queue, job)
+	js.lock.Unlock()
+	select {
+	case js.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (js *JobScheduler) remove(key string) {
+	js.lock.Lock()
+	js.removeUnlocked(key)
+	js.lock.Unlock()
+}
+
+func (js *JobScheduler) removeUnlocked(key string) {
+	for i, queued := range js.queue {
+		if queued.Key == key {
+			heap.Remove(&js.queue, i)
+			return
+		}
+	}
+}
+
+func (js *JobScheduler) popDue() *Job {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	if len(js.queue) == 0 || js.queue[0].RunAt.After(time.Now()) {
+		return nil
+	}
+	return heap.Pop(&js.queue).(*Job)
+}
+
+func (js *JobScheduler) nextRunAt() (time.Time, bool) {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	if len(js.queue) == 0 {
+		return time.Time{}, false
+	}
+	return js.queue[0].RunAt, true
+}
+
+// Jobs that are still running when the context is canceled are waited for before Run returns.
+func (js *JobScheduler) Run(ctx context.Context) {
+	log := globalLog.With().Str("action", "job scheduler").Logger()
+	ctx = log.WithContext(ctx)
+	jobs, err := db.GetPendingJobs(ctx, jobMaxAttempts)
+	if err != nil {
+		log.Err(err).Msg("Failed to get scheduled jobs from database")
+	} else {
+		log.Debug().Int("count", len(jobs)).Msg("Loaded scheduled jobs from database")
+		for _, job := range jobs {
+			js.push(job)
+		}
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		for job := js.popDue(); job != nil; job = js.popDue() {
+			js.running.Add(1)
+			go js.run(ctx, job)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next, ok := js.nextRunAt(); ok {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("Stopping job scheduler")
+			js.running.Wait()
+			return
+		case <-js.wakeup:
+		case <-timer.C:
+		}
+	}
+}
+
+func jobBackoff(attempts int) time.Duration {
+	backoff := jobRetryBackoff << (attempts - 1)
+	if backoff > jobMaxBackoff || backoff <= 0 {
+		backoff = jobMaxBackoff
+	}
+	return backoff
+}
+
+// runJobHandler turns panics into errors, so that they're retried like any other failure instead of crashing botbot.
+func runJobHandler(ctx context.Context, handler JobHandler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			zerolog.Ctx(ctx).Error().
+				Interface("error", r).
+				Bytes("stack", debug.Stack()).
+				Msg("Panic while running job")
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func (js *JobScheduler) run(ctx context.Context, job *Job) {
+	defer js.running.Done()
+	logCtx := zerolog.Ctx(ctx).With().
+		Str("job_key", job.Key).
+		Str("job_action", string(job.Action)).
+		Int("attempt", job.Attempts+1)
+	if job.RequestID != "" {
+		// Each attempt gets its own request ID, this links it to the command that scheduled the job
+		logCtx = logCtx.Str("origin_request_id", job.RequestID)
+	}
+	ctx, span := startRequest(logCtx.Logger().WithContext(ctx), "job "+string(job.Action),
+		attribute.String("botbot.job_key", job.Key),
+		attribute.Int("botbot.attempt", job.Attempts+1),
+		attribute.String("botbot.origin_request_id", job.RequestID),
+	)
+	defer span.End()
+	log := *zerolog.Ctx(ctx)
+	// The job bookkeeping shouldn't be interrupted if the scheduler is stopped while the handler is running
+	dbCtx := detachContext(ctx)
+	handler, ok := jobHandlers[job.Action]
+	var err error
+	if !ok {
+		err = fmt.Errorf("unknown job action %q", job.Action)
+	} else {
+		err = runJobHandler(ctx, handler, job)
+	}
+	if err == nil {
+		log.Debug().Msg("Job completed")
+		err = db.FinishJob(dbCtx, job)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to remove completed job from database")
+		}
+		return
+	}
+	setSpanError(ctx, err, "job failed")
+	job.Attempts++
+	job.LastError = err.Error()
+	retryAt := time.Now().Add(jobBackoff(job.Attempts))
+	unchanged, dbErr := db.SetJobRetry(dbCtx, job, retryAt)
+	if dbErr != nil {
+		log.Warn().Err(dbErr).Msg("Failed to store job attempt in database")
+	}
+	if dbErr == nil && !unchanged {
+		log.Err(err).Msg("Job failed, but it was rescheduled or cancelled while running")
+	} else if job.Attempts >= jobMaxAttempts {
+		// The job stays in the database with its last error, but it won't be loaded again
+		log.Err(err).Msg("Job failed, giving up")
+		auditSystem(dbCtx, AuditJobFailed, "", "´%s´ failed %d times, giving up: %s", job.Key, job.Attempts, job.LastError)
+	} else {
+		log.Err(err).Time("retry_at", retryAt).Msg("Job failed, will retry")
+		job.RunAt = retryAt
+		js.push(job)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const jobActionTest JobAction = "test"
+
+// runTestJob stores a job with the given number of previous attempts and runs it once with the given handler.
+func runTestJob(t *testing.T, ctx context.Context, attempts int, handler JobHandler) (*JobScheduler, *Job) {
+	jobHandlers[jobActionTest] = handler
+	t.Cleanup(func() {
+		delete(jobHandlers, jobActionTest)
+	})
+	job := &Job{
+		Key:      "test:job",
+		Action:   jobActionTest,
+		Payload:  []byte("{}"),
+		RunAt:    time.UnixMilli(time.Now().UnixMilli()),
+		Attempts: attempts,
+	}
+	if err := db.UpsertJob(ctx, job); err != nil {
+		t.Fatalf("Failed to store job: %v", err)
+	} else if attempts > 0 {
+		// UpsertJob always resets the attempt counter
+		if _, err = db.SetJobRetry(ctx, job, job.RunAt); err != nil {
+			t.Fatalf("Failed to set job attempts: %v", err)
+		}
+	}
+	js := &JobScheduler{wakeup: make(chan struct{}, 1)}
+	js.running.Add(1)
+	js.run(ctx, job)
+	return js, job
+}
+
+func TestJobBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, jobMaxBackoff},
+		{100, jobMaxBackoff},
+	}
+	for _, test := range tests {
+		if backoff := jobBackoff(test.attempts); backoff != test.expected {
+			t.Errorf("Expected backoff %s after %d attempts, got %s", test.expected, test.attempts, backoff)
+		}
+	}
+}
+
+func TestJobSuccess(t *testing.T) {
+	ctx, _ := setupTestEnv(t)
+	js, job := runTestJob(t, ctx, 0, func(ctx context.Context, job *Job) error {
+		return nil
+	})
+	if stored, err := db.GetJob(ctx, job.Key); err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	} else if stored != nil {
+		t.Errorf("Completed job wasn't removed from database")
+	}
+	if len(js.queue) != 0 {
+		t.Errorf("Completed job was queued again")
+	}
+}
+
+func TestJobRetry(t *testing.T) {
+	ctx, _ := setupTestEnv(t)
+	start := time.Now()
+	js, job := runTestJob(t, ctx, 1, func(ctx context.Context, job *Job) error {
+		return errors.New("test failure")
+	})
+	stored, err := db.GetJob(ctx, job.Key)
+	if err != nil || stored == nil {
+		t.Fatalf("Failed job wasn't kept in database: %v", err)
+	}
+	if stored.Attempts != 2 || stored.LastError != "test failure" {
+		t.Errorf("Unexpected attempt info %d/%q", stored.Attempts, stored.LastError)
+	}
+	expectedRetry := start.Add(jobBackoff(2))
+	if stored.RunAt.Before(expectedRetry.Add(-time.Second)) || stored.RunAt.After(expectedRetry.Add(time.Second)) {
+		t.Errorf("Expected retry at around %s, got %s", expectedRetry, stored.RunAt)
+	}
+	if len(js.queue) != 1 || js.queue[0].Key != job.Key || js.queue[0].RunAt.UnixMilli() != stored.RunAt.UnixMilli() {
+		t.Errorf("Failed job wasn't queued for retry")
+	}
+}
+
+func TestJobPanic(t *testing.T) {
+	ctx, _ := setupTestEnv(t)
+	js, job := runTestJob(t, ctx, 0, func(ctx context.Context, job *Job) error {
+		panic("test panic")
+	})
+	stored, err := db.GetJob(ctx, job.Key)
+	if err != nil || stored == nil {
+		t.Fatalf("Panicking job wasn't kept in database: %v", err)
+	}
+	if stored.Attempts != 1 || stored.LastError != "panic: test panic" {
+		t.Errorf("Unexpected attempt info %d/%q", stored.Attempts, stored.LastError)
+	}
+	if len(js.queue) != 1 {
+		t.Errorf("Panicking job wasn't queued for retry")
+	}
+}
+
+func TestJobGiveUp(t *testing.T) {
+	ctx, _ := setupTestEnv(t)
+	js, job := runTestJob(t, ctx, jobMaxAttempts-1, func(ctx context.Context, job *Job) error {
+		return errors.New("test failure")
+	})
+	stored, err := db.GetJob(ctx, job.Key)
+	if err != nil || stored == nil {
+		t.Fatalf("Job that ran out of attempts wasn't kept in database: %v", err)
+	}
+	if stored.Attempts != jobMaxAttempts || stored.LastError != "test failure" {
+		t.Errorf("Unexpected attempt info %d/%q", stored.Attempts, stored.LastError)
+	}
+	if pending, err := db.GetPendingJobs(ctx, jobMaxAttempts); err != nil {
+		t.Fatalf("Failed to get pending jobs: %v", err)
+	} else if len(pending) != 0 {
+		t.Errorf("Job that ran out of attempts is still pending")
+	}
+	if len(js.queue) != 0 {
+		t.Errorf("Job that ran out of attempts was queued again")
+	}
+	entries, err := db.GetAuditLog(ctx, &AuditFilter{Action: AuditJobFailed, Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to get audit log: %v", err)
+	} else if len(entries) != 1 {
+		t.Errorf("Expected 1 audit entry for the failed job, got %d", len(entries))
+	}
+}
+
+func TestJobRescheduledWhileRunning(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		ctx, _ := setupTestEnv(t)
+		newRunAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+		js, job := runTestJob(t, ctx, 0, func(ctx context.Context, job *Job) error {
+			if err := scheduleJob(ctx, job.Key, jobActionTest, struct{}{}, newRunAt); err != nil {
+				t.Fatalf("Failed to reschedule job: %v", err)
+			}
+			if fail {
+				return errors.New("test failure")
+			}
+			return nil
+		})
+		stored, err := db.GetJob(ctx, job.Key)
+		if err != nil || stored == nil {
+			t.Fatalf("Rescheduled job was removed from database (failed: %t): %v", fail, err)
+		}
+		if !stored.RunAt.Equal(newRunAt) || stored.Attempts != 0 {
+			t.Errorf("Rescheduled job was overwritten (failed: %t): run at %s, %d attempts", fail, stored.RunAt, stored.Attempts)
+		}
+		if len(js.queue) != 0 {
+			t.Errorf("Old job was queued again (failed: %t)", fail)
+		}
+	}
+}
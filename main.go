@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -34,12 +35,13 @@ var (
 )
 
 type Config struct {
-	HomeserverURL string `env:"HOMESERVER_URL,notEmpty"`
-	Username      string `env:"USERNAME,notEmpty"`
-	Password      string `env:"PASSWORD,notEmpty"`
-	DatabaseURI   string `env:"DATABASE_URI" envDefault:"botbot.db"`
-	DatabaseType  string `env:"DATABASE_TYPE" envDefault:"sqlite3-fk-wal"`
-	PickleKey     string `env:"PICKLE_KEY" envDefault:"meow"`
+	HomeserverURL       string `env:"HOMESERVER_URL,notEmpty"`
+	PublicHomeserverURL string `env:"PUBLIC_HOMESERVER_URL"`
+	Username            string `env:"USERNAME,notEmpty"`
+	Password            string `env:"PASSWORD,notEmpty"`
+	DatabaseURI         string `env:"DATABASE_URI" envDefault:"botbot.db"`
+	DatabaseType        string `env:"DATABASE_TYPE" envDefault:"sqlite3-fk-wal"`
+	PickleKey           string `env:"PICKLE_KEY" envDefault:"meow"`
 
 	BeeperAPIURL string `env:"BEEPER_API_URL"`
 
@@ -48,12 +50,46 @@ type Config struct {
 
 	LogLevel zerolog.Level `env:"LOG_LEVEL" envDefault:"debug"`
 
+	APIListenAddress     string `env:"API_LISTEN_ADDRESS"`
+	OpenIDServerURL      string `env:"OPENID_SERVER_URL"`
+	MetricsListenAddress string `env:"METRICS_LISTEN_ADDRESS"`
+	OTLPEndpoint         string `env:"OTLP_ENDPOINT"`
+
 	MaxBotsPerUser int `env:"MAX_BOTS_PER_USER" envDefault:"10"`
+	MaxBotsPerTeam int `env:"MAX_BOTS_PER_TEAM" envDefault:"50"`
+
+	TeamOwnerPowerLevel      int `env:"TEAM_OWNER_POWER_LEVEL" envDefault:"100"`
+	TeamMaintainerPowerLevel int `env:"TEAM_MAINTAINER_POWER_LEVEL" envDefault:"50"`
+
+	Admins    []string  `env:"ADMINS" envSeparator:","`
+	AdminRoom id.RoomID `env:"ADMIN_ROOM"`
+
+	CreateApproval       bool     `env:"CREATE_APPROVAL"`
+	CreateApprovers      []string `env:"CREATE_APPROVERS" envSeparator:","`
+	CreateRequirePurpose bool     `env:"CREATE_REQUIRE_PURPOSE"`
+
+	OwnerDeactivationPolicy OwnerDeactivationPolicy `env:"OWNER_DEACTIVATION_POLICY" envDefault:"none"`
+	FallbackOwner           id.UserID               `env:"FALLBACK_OWNER"`
+
+	BotDisablePushRules bool                `env:"BOT_DISABLE_PUSH_RULES" envDefault:"true"`
+	BotPresence         event.Presence      `env:"BOT_PRESENCE" envDefault:"offline"`
+	BotAccountData      AccountDataDefaults `env:"BOT_ACCOUNT_DATA"`
+
+	SelfDestructDelay     time.Duration `env:"SELF_DESTRUCT_DELAY" envDefault:"5m"`
+	MinSelfDestructDelay  time.Duration `env:"MIN_SELF_DESTRUCT_DELAY" envDefault:"10s"`
+	MaxSelfDestructDelay  time.Duration `env:"MAX_SELF_DESTRUCT_DELAY" envDefault:"1h"`
+	SelfDestructAfterRead bool          `env:"SELF_DESTRUCT_AFTER_READ" envDefault:"true"`
+	SelfDestructReadGrace time.Duration `env:"SELF_DESTRUCT_READ_GRACE" envDefault:"30s"`
+
+	ReconcileInterval          time.Duration `env:"RECONCILE_INTERVAL" envDefault:"6h"`
+	InactivityWarningPeriod    time.Duration `env:"INACTIVITY_WARNING_PERIOD" envDefault:"720h"`
+	InactivityDeactivatePeriod time.Duration `env:"INACTIVITY_DEACTIVATE_PERIOD" envDefault:"0"`
 }
 
 var cli *mautrix.Client
 var synadm *synapseadmin.Client
 var db *Database
+var cryptoHelper *cryptohelper.CryptoHelper
 var cfg Config
 var globalLog = zerolog.New(os.Stdout).With().Timestamp().Logger()
 
@@ -72,6 +108,17 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to parse environment variables")
 	}
+	if !cfg.OwnerDeactivationPolicy.IsValid() {
+		log.Fatal().Str("policy", string(cfg.OwnerDeactivationPolicy)).Msg("Invalid owner deactivation policy")
+	}
+	if cfg.InactivityDeactivatePeriod > 0 && cfg.InactivityWarningPeriod <= 0 {
+		log.Fatal().Msg("Inactive bots can't be deactivated without warning, INACTIVITY_WARNING_PERIOD must be set")
+	} else if cfg.InactivityDeactivatePeriod > 0 && cfg.InactivityDeactivatePeriod <= cfg.InactivityWarningPeriod {
+		log.Fatal().
+			Dur("warning_period", cfg.InactivityWarningPeriod).
+			Dur("deactivate_period", cfg.InactivityDeactivatePeriod).
+			Msg("INACTIVITY_DEACTIVATE_PERIOD must be longer than INACTIVITY_WARNING_PERIOD")
+	}
 	log = log.Level(cfg.LogLevel)
 	globalLog = log
 	zerolog.TimeFieldFormat = time.RFC3339Nano
@@ -84,6 +131,15 @@ func main() {
 		Str("mautrix_version", mautrix.VersionWithCommit).
 		Msg("Initializing botbot")
 
+	var shutdownTracing func(context.Context) error
+	if cfg.OTLPEndpoint != "" {
+		shutdownTracing, err = initTracing(context.Background())
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize tracing")
+		}
+		log.Info().Str("endpoint", cfg.OTLPEndpoint).Msg("Exporting traces to OpenTelemetry collector")
+	}
+
 	cli, err = mautrix.NewClient(cfg.HomeserverURL, "", "")
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize mautrix client")
@@ -105,8 +161,18 @@ func main() {
 	}
 	db = &Database{Database: rawDB}
 
+	var metricsServer *http.Server
+	if cfg.MetricsListenAddress != "" {
+		metricsServer = startMetricsServer(log)
+	}
+
+	err = ensureReconcileJob(log.WithContext(context.Background()))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to schedule reconcile job")
+	}
+
 	log.Debug().Msg("Initializing crypto helper")
-	cryptoHelper, err := cryptohelper.NewCryptoHelper(cli, []byte(cfg.PickleKey), rawDB)
+	cryptoHelper, err = cryptohelper.NewCryptoHelper(cli, []byte(cfg.PickleKey), rawDB)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create crypto helper")
 	}
@@ -122,16 +188,20 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed to initialize crypto helper")
 	}
 	cli.Crypto = cryptoHelper
+	cryptoIsInit.Store(true)
 
 	log.Info().Msg("Initialization complete")
 
 	syncer := cli.Syncer.(*mautrix.DefaultSyncer)
 	syncer.OnEventType(event.StateMember, handleMember)
 	syncer.OnEventType(event.EventMessage, handleMessage)
+	syncer.OnEventType(event.EphemeralEventReceipt, handleReceipt)
 	syncer.OnSync(cli.MoveInviteState)
 	cryptoHelper.Machine().SendKeysMinTrust = id.TrustStateCrossSignedTOFU
 	cryptoHelper.Machine().ShareKeysMinTrust = id.TrustStateCrossSignedTOFU
+	syncer.OnSync(trackSync)
 	cryptoHelper.DecryptErrorCallback = func(evt *event.Event, err error) {
+		metricDecryptionFailures.Inc()
 		_, _ = cli.SendMessageEvent(evt.RoomID, event.EventMessage, &event.MessageEventContent{
 			MsgType:   event.MsgNotice,
 			Body:      "Failed to decrypt message",
@@ -141,18 +211,29 @@ func main() {
 
 	syncCtx, cancelSync := context.WithCancel(context.Background())
 	var syncStopWait sync.WaitGroup
-	syncStopWait.Add(1)
+	syncStopWait.Add(2)
 
 	go func() {
 		defer syncStopWait.Done()
 		log.Debug().Msg("Starting syncing")
+		syncRunning.Store(true)
+		syncStartAt.Store(time.Now().UnixMilli())
 		err = cli.SyncWithContext(syncCtx)
+		syncRunning.Store(false)
 		if err != nil && !errors.Is(err, context.Canceled) {
 			log.WithLevel(zerolog.FatalLevel).Err(err).Msg("Fatal error in syncer")
 			cancelSync()
 		}
 	}()
-	go restartSelfDestruct()
+	go func() {
+		defer syncStopWait.Done()
+		jobScheduler.Run(syncCtx)
+	}()
+
+	var provisioningServer *http.Server
+	if cfg.APIListenAddress != "" {
+		provisioningServer = startProvisioningAPI(log)
+	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -165,8 +246,27 @@ func main() {
 		exitCode = 2
 	}
 
+	for _, server := range []*http.Server{provisioningServer, metricsServer} {
+		if server == nil {
+			continue
+		}
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+		err = server.Shutdown(shutdownCtx)
+		cancelShutdown()
+		if err != nil {
+			log.Error().Err(err).Str("address", server.Addr).Msg("Error stopping HTTP server")
+		}
+	}
 	cancelSync()
 	syncStopWait.Wait()
+	if shutdownTracing != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+		err = shutdownTracing(shutdownCtx)
+		cancelShutdown()
+		if err != nil {
+			log.Error().Err(err).Msg("Error flushing traces")
+		}
+	}
 	err = cryptoHelper.Close()
 	if err != nil {
 		log.Error().Err(err).Msg("Error closing database")
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/synapseadmin"
+	"maunium.net/go/mautrix/util/dbutil"
+
+	"github.com/beeper/botbot/upgrades"
+)
+
+const testServerName = "example.com"
+
+// fakeHomeserver answers the homeserver and Synapse admin API requests botbot makes.
+// Requests without a specific handler get an empty JSON object, which is enough for most endpoints.
+type fakeHomeserver struct {
+	*httptest.Server
+	Mux *http.ServeMux
+}
+
+func newFakeHomeserver(t *testing.T) *fakeHomeserver {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	mux.HandleFunc("/_matrix/client/v3/login", func(w http.ResponseWriter, r *http.Request) {
+		var req mautrix.ReqLogin
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		writeJSON(w, http.StatusOK, &mautrix.RespLogin{
+			UserID:      id.UserID(req.Identifier.User),
+			DeviceID:    "TESTDEVICE",
+			AccessToken: "bot_token",
+		})
+	})
+	mux.HandleFunc("/_synapse/admin/v1/username_available", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]bool{"available": true})
+	})
+	mux.HandleFunc("/_matrix/federation/v1/openid/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, &respOpenIDUserInfo{Sub: id.UserID(r.URL.Query().Get("access_token"))})
+	})
+	hs := &fakeHomeserver{Server: httptest.NewServer(mux), Mux: mux}
+	t.Cleanup(hs.Close)
+	return hs
+}
+
+// setupTestEnv replaces the global config, client and database with ones backed by a fake homeserver
+// and a temporary SQLite database.
+func setupTestEnv(t *testing.T) (context.Context, *fakeHomeserver) {
+	hs := newFakeHomeserver(t)
+	cfg = Config{
+		HomeserverURL:  hs.URL,
+		RegisterSecret: "secret",
+		MaxBotsPerUser: 10,
+		MaxBotsPerTeam: 50,
+		BotPresence:    "none",
+	}
+	var err error
+	cli, err = mautrix.NewClient(hs.URL, id.NewUserID("botbot", testServerName), "botbot_token")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	cli.Log = zerolog.Nop()
+	synadm = &synapseadmin.Client{Client: cli}
+	rawDB, err := dbutil.NewWithDialect(filepath.Join(t.TempDir(), "botbot.db"), "sqlite3-fk-wal")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	rawDB.Owner = "botbot"
+	rawDB.UpgradeTable = upgrades.Table
+	if err = rawDB.Upgrade(); err != nil {
+		t.Fatalf("Failed to upgrade database: %v", err)
+	}
+	db = &Database{Database: rawDB}
+	jobScheduler = &JobScheduler{wakeup: make(chan struct{}, 1)}
+	t.Cleanup(func() {
+		_ = rawDB.RawDB.Close()
+		db = nil
+	})
+	return zerolog.Nop().WithContext(context.Background()), hs
+}
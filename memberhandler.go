@@ -22,7 +22,10 @@ func handleMember(source mautrix.EventSource, evt *event.Event) {
 		Str("event_id", evt.ID.String()).
 		Str("action", "membership event").
 		Logger()
-	ctx := log.WithContext(context.WithValue(context.Background(), contextKeyEvent, evt))
+	ctx, span := startRequest(log.WithContext(context.Background()), "handle membership event")
+	defer span.End()
+	log = *zerolog.Ctx(ctx)
+	ctx = context.WithValue(ctx, contextKeyEvent, evt)
 	log.Debug().
 		Str("room_id", evt.RoomID.String()).
 		Str("sender", evt.Sender.String()).
@@ -35,21 +38,36 @@ func handleMember(source mautrix.EventSource, evt *event.Event) {
 		if content.Membership != event.MembershipInvite || source&mautrix.EventSourceInvite == 0 {
 			log.Debug().Msg("Ignoring non-invite member event for self")
 		} else if evt.Sender.Homeserver() != cli.UserID.Homeserver() {
-			log.Debug().Msg("Rejecting invite from user on different homeserver")
-			leaveRoom(ctx, evt.RoomID, fmt.Sprintf("This bot only serves users on %s", cli.UserID.Homeserver()))
+			log.Info().Str("sender", evt.Sender.String()).Msg("Rejecting invite from user on different homeserver")
+			rejectInvite(ctx, evt, fmt.Sprintf("This bot only serves users on %s", cli.UserID.Homeserver()), "inviter is on a different homeserver")
+		} else if isGroup, err := isGroupRoom(ctx, evt.RoomID); err != nil {
+			log.Err(err).Msg("Failed to check if invite is to a team room")
+		} else if isGroup {
+			log.Debug().Msg("Accepting invite to team or admin room")
+			joinGroupRoom(ctx, evt.RoomID)
+		} else if popExpectedTeamInvite(evt.RoomID, evt.Sender) {
+			log.Debug().Msg("Accepting invite to room the inviter is transferring a bot to")
+			joinGroupRoom(ctx, evt.RoomID)
 		} else if bot, _ := db.GetBot(ctx, id.UserID(evt.GetStateKey())); bot != nil {
 			log.Debug().Msg("Rejecting invite from a bot managed by this bot")
-			leaveRoom(ctx, evt.RoomID, "Bots can't have their own bots")
+			rejectInvite(ctx, evt, "Bots can't have their own bots", "inviter is a bot")
 		} else if stateProblem := inviteLooksPrivate(evt); stateProblem != "" {
 			log.Debug().
 				Str("problem", stateProblem).
 				Msg("Rejecting invite to room that doesn't look like a private chat")
-			leaveRoom(ctx, evt.RoomID, "This bot only accepts invites to encrypted direct chats")
+			rejectInvite(ctx, evt, "This bot only accepts invites to encrypted direct chats", stateProblem)
 		} else {
 			log.Debug().Msg("Accepting direct chat invite")
 			acceptInvite(ctx, evt)
 		}
 	} else if source&mautrix.EventSourceJoin > 0 {
+		if isGroup, err := isGroupRoom(ctx, evt.RoomID); err != nil {
+			log.Err(err).Msg("Failed to check if member event is in a team room")
+			return
+		} else if isGroup {
+			log.Debug().Msg("Ignoring member event in team or admin room")
+			return
+		}
 		_, err := getOtherUserID(ctx, evt.RoomID, false, true)
 		if errors.Is(err, errWrongMemberCount) {
 			log.Debug().Msg("Room has more than 2 members now, leaving")
@@ -65,6 +83,15 @@ func handleMember(source mautrix.EventSource, evt *event.Event) {
 	}
 }
 
+func rejectInvite(ctx context.Context, evt *event.Event, reason, problem string) {
+	metricRejectedInvites.Inc()
+	// Anyone on any server can send invites, so only invites from local users are worth an audit notice
+	if evt.Sender.Homeserver() == cli.UserID.Homeserver() {
+		audit(ctx, &AuditEntry{Action: AuditInviteRejected, Actor: evt.Sender, RoomID: evt.RoomID, Details: problem})
+	}
+	leaveRoom(ctx, evt.RoomID, reason)
+}
+
 func leaveRoom(ctx context.Context, roomID id.RoomID, reason string) {
 	_, err := cli.LeaveRoom(roomID, &mautrix.ReqLeave{Reason: reason})
 	if err != nil {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -18,6 +19,9 @@ type contextKey int
 const (
 	contextKeyEvent contextKey = iota
 	contextKeyCmdContext
+	contextKeyCommandAudit
+	contextKeyAPIUser
+	contextKeyRequestID
 )
 
 func getEvent(ctx context.Context) *event.Event {
@@ -28,11 +32,30 @@ func getEvent(ctx context.Context) *event.Event {
 	return evt
 }
 
+// getEventRoomID returns the room of the current command, or an empty string for provisioning API requests.
+func getEventRoomID(ctx context.Context) id.RoomID {
+	if evt, ok := ctx.Value(contextKeyEvent).(*event.Event); ok {
+		return evt.RoomID
+	}
+	return ""
+}
+
 func replyErr(ctx context.Context, err error, message string) {
 	zerolog.Ctx(ctx).Err(err).Msg(message)
+	setSpanError(ctx, err, message)
+	auditCommandFailure(ctx, err, message)
 	reply(ctx, message)
 }
 
+func replyError(ctx context.Context, err error, message string) {
+	var userErr *UserError
+	if errors.As(err, &userErr) {
+		reply(ctx, userErr.Message)
+	} else {
+		replyErr(ctx, err, message)
+	}
+}
+
 func reply(ctx context.Context, message string, args ...any) id.EventID {
 	return replyOpts(ctx, ReplyOpts{}, message, args...)
 }
@@ -41,21 +64,53 @@ type ReplyOpts struct {
 	DontEncrypt bool
 }
 
-func replyOpts(ctx context.Context, opts ReplyOpts, message string, args ...any) id.EventID {
-	evt := getEvent(ctx)
+func renderNotice(message string, args ...any) *event.MessageEventContent {
 	if len(args) > 0 {
 		message = fmt.Sprintf(message, args...)
 	}
 	message = strings.ReplaceAll(message, "´", "`")
 	content := format.RenderMarkdown(message, true, true)
 	content.MsgType = event.MsgNotice
+	return &content
+}
+
+func replyOpts(ctx context.Context, opts ReplyOpts, message string, args ...any) id.EventID {
+	return replyContent(ctx, opts, renderNotice(message, args...))
+}
+
+// notifyUser sends a notice to the direct chat where the given user last used a command.
+func notifyUser(ctx context.Context, userID id.UserID, message string, args ...any) error {
+	user, err := db.GetUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	} else if user.ManagementRoom == "" {
+		return fmt.Errorf("no known management room for %s", userID)
+	}
+	_, err = sendNotice(ctx, user.ManagementRoom, message, args...)
+	return err
+}
+
+func sendNotice(ctx context.Context, roomID id.RoomID, message string, args ...any) (id.EventID, error) {
+	resp, err := cli.SendMessageEvent(roomID, event.EventMessage, renderNotice(message, args...))
+	if err != nil {
+		return "", err
+	}
+	zerolog.Ctx(ctx).Debug().
+		Str("room_id", roomID.String()).
+		Str("notice_event_id", resp.EventID.String()).
+		Msg("Sent notice")
+	return resp.EventID, nil
+}
+
+func replyContent(ctx context.Context, opts ReplyOpts, content *event.MessageEventContent) id.EventID {
+	evt := getEvent(ctx)
 	relatable, ok := evt.Content.Parsed.(*event.MessageEventContent)
 	if ok && relatable.GetRelatesTo().GetThreadParent() != "" {
 		content.RelatesTo = (&event.RelatesTo{}).SetThread(relatable.GetRelatesTo().GetThreadParent(), evt.ID)
 	} else {
 		content.RelatesTo = (&event.RelatesTo{}).SetReplyTo(evt.ID)
 	}
-	resp, err := cli.SendMessageEvent(evt.RoomID, event.EventMessage, &content, mautrix.ReqSendEvent{
+	resp, err := cli.SendMessageEvent(evt.RoomID, event.EventMessage, content, mautrix.ReqSendEvent{
 		DontEncrypt: opts.DontEncrypt,
 	})
 	if err != nil {
@@ -76,13 +131,20 @@ func handleMessage(source mautrix.EventSource, evt *event.Event) {
 		Str("event_id", evt.ID.String()).
 		Str("action", "incoming message").
 		Logger()
+	ctx, span := startRequest(log.WithContext(context.Background()), "handle message")
+	defer span.End()
+	log = *zerolog.Ctx(ctx)
+	ctx = context.WithValue(ctx, contextKeyEvent, evt)
 	log.Debug().
 		Str("room_id", evt.RoomID.String()).
 		Str("sender", evt.Sender.String()).
 		Time("message_timestamp", time.UnixMilli(evt.Timestamp)).
 		Msg("Received message event")
-	ctx := log.WithContext(context.WithValue(context.Background(), contextKeyEvent, evt))
-	if expectedUserID, err := getOtherUserID(ctx, evt.RoomID, true, true); err != nil {
+	if isGroup, err := isGroupRoom(ctx, evt.RoomID); err != nil {
+		log.Warn().Err(err).Msg("Ignoring message: failed to check if room is a team room")
+	} else if isGroup {
+		log.Debug().Msg("Ignoring message in team or admin room")
+	} else if expectedUserID, err := getOtherUserID(ctx, evt.RoomID, true, true); err != nil {
 		log.Warn().Err(err).Msg("Ignoring message: failed to check expected user ID in room")
 	} else if expectedUserID != evt.Sender {
 		log.Debug().Str("expected_sender", expectedUserID.String()).Msg("Ignoring message from unexpected user")
@@ -107,8 +169,16 @@ func handleMessage(source mautrix.EventSource, evt *event.Event) {
 		case id.TrustStateUnset:
 			msg += " (unverified)"
 		}
+		details := "trust state " + evt.Mautrix.TrustState.String()
+		if evt.Mautrix.TrustSource != nil {
+			details += ", device " + evt.Mautrix.TrustSource.DeviceID.String()
+		}
+		audit(ctx, &AuditEntry{Action: AuditUntrustedDevice, Actor: evt.Sender, RoomID: evt.RoomID, Details: details})
 		replyOpts(ctx, ReplyOpts{DontEncrypt: true}, msg)
 	} else {
+		if err = db.SetManagementRoom(ctx, evt.Sender, evt.RoomID); err != nil {
+			log.Warn().Err(err).Msg("Failed to store management room of user")
+		}
 		handleCommand(ctx, evt)
 	}
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix"
+)
+
+// Syncs long-poll for 30 seconds, so there should be a successful one at least every minute.
+const maxSyncAge = 2 * time.Minute
+
+var (
+	metricCommands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "botbot_commands_total",
+		Help: "Number of commands handled by name and outcome",
+	}, []string{"command", "outcome"})
+	metricAccountOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "botbot_account_operation_duration_seconds",
+		Help: "Time taken to register bot accounts and log into them",
+	}, []string{"operation", "outcome"})
+	metricDecryptionFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "botbot_decryption_failures_total",
+		Help: "Number of events that couldn't be decrypted",
+	})
+	metricRejectedInvites = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "botbot_rejected_invites_total",
+		Help: "Number of invites that were rejected",
+	})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "botbot_self_destruct_queue_depth",
+		Help: "Number of messages waiting to self-destruct",
+	}, getSelfDestructQueueDepth)
+)
+
+var (
+	syncRunning  atomic.Bool
+	syncStartAt  atomic.Int64
+	lastSyncAt   atomic.Int64
+	cryptoIsInit atomic.Bool
+)
+
+func getSelfDestructQueueDepth() float64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	count, err := db.CountJobsByAction(ctx, JobActionRedactEvent)
+	if err != nil {
+		globalLog.Warn().Err(err).Msg("Failed to count self-destructing messages for metrics")
+		return 0
+	}
+	return float64(count)
+}
+
+func observeAccountOperation(operation string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	metricAccountOperationDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+func trackSync(_ *mautrix.RespSync, _ string) bool {
+	lastSyncAt.Store(time.Now().UnixMilli())
+	return true
+}
+
+type respHealth struct {
+	OK       bool   `json:"ok"`
+	Sync     string `json:"sync,omitempty"`
+	Database string `json:"database,omitempty"`
+	Crypto   string `json:"crypto,omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, resp *respHealth) {
+	status := http.StatusOK
+	if !resp.OK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+// Until the first sync has had time to complete, e.g. while the crypto helper is being initialized,
+// the sync loop is considered healthy.
+func checkSync() (bool, string) {
+	startedAt := syncStartAt.Load()
+	lastSync := lastSyncAt.Load()
+	if startedAt == 0 {
+		return true, "starting"
+	} else if !syncRunning.Load() {
+		return false, "not running"
+	} else if lastSync == 0 {
+		if time.Since(time.UnixMilli(startedAt)) > maxSyncAge {
+			return false, "no successful sync since start"
+		}
+		return true, "waiting for first sync"
+	} else if lastSyncTime := time.UnixMilli(lastSync); time.Since(lastSyncTime) > maxSyncAge {
+		return false, "last successful sync was at " + lastSyncTime.UTC().Format(time.RFC3339)
+	}
+	return true, "ok"
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp := &respHealth{Database: "ok"}
+	resp.OK, resp.Sync = checkSync()
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if err := db.RawDB.PingContext(ctx); err != nil {
+		resp.OK = false
+		resp.Database = err.Error()
+	}
+	writeHealth(w, resp)
+}
+
+func handleReady(w http.ResponseWriter, _ *http.Request) {
+	if cryptoIsInit.Load() {
+		writeHealth(w, &respHealth{OK: true, Crypto: "ok"})
+	} else {
+		writeHealth(w, &respHealth{OK: false, Crypto: "not initialized"})
+	}
+}
+
+// The handlers use the database, so it must be initialized before startMetricsServer is called.
+func startMetricsServer(log zerolog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handleHealth)
+	mux.HandleFunc("/ready", handleReady)
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{
+		Addr:              cfg.MetricsListenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Info().Str("address", cfg.MetricsListenAddress).Msg("Starting health and metrics server")
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Error in health and metrics server")
+		}
+	}()
+	return server
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/id"
+)
+
+type OwnerDeactivationPolicy string
+
+const (
+	OwnerDeactivationNone       OwnerDeactivationPolicy = "none"
+	OwnerDeactivationTransfer   OwnerDeactivationPolicy = "transfer"
+	OwnerDeactivationSuspend    OwnerDeactivationPolicy = "suspend"
+	OwnerDeactivationDeactivate OwnerDeactivationPolicy = "deactivate"
+)
+
+func (odp OwnerDeactivationPolicy) IsValid() bool {
+	switch odp {
+	case OwnerDeactivationNone, OwnerDeactivationTransfer, OwnerDeactivationSuspend, OwnerDeactivationDeactivate:
+		return true
+	default:
+		return false
+	}
+}
+
+const ownerDeactivatedTransferNotice = "%s owned the bot ´%s´, but their account was deactivated, so it was transferred to you."
+
+func getFallbackOwner() id.UserID {
+	if cfg.FallbackOwner != "" {
+		return cfg.FallbackOwner
+	} else if len(cfg.Admins) > 0 {
+		return id.UserID(cfg.Admins[0])
+	}
+	return ""
+}
+
+// Errors from the admin API, including the owner not being found, aren't treated as deactivation.
+// Results are cached in the given map, so that owners with many bots are only checked once per reconcile.
+func isOwnerDeactivated(ctx context.Context, owner id.UserID, cache map[id.UserID]bool) (bool, error) {
+	if deactivated, ok := cache[owner]; ok {
+		return deactivated, nil
+	}
+	userInfo, err := synadm.GetUserInfo(ctx, owner)
+	if err != nil {
+		return false, fmt.Errorf("failed to get owner info: %w", err)
+	}
+	cache[owner] = userInfo.Deactivated
+	return userInfo.Deactivated, nil
+}
+
+// Bots owned by team rooms are left alone, as the team is still responsible for them.
+func checkOwnerDeactivated(ctx context.Context, bot *Bot, cache map[id.UserID]bool) (bool, error) {
+	if cfg.OwnerDeactivationPolicy == OwnerDeactivationNone || bot.OwnerRoom != "" {
+		return false, nil
+	} else if deactivated, err := isOwnerDeactivated(ctx, bot.OwnerMXID, cache); err != nil || !deactivated {
+		return false, err
+	}
+	log := zerolog.Ctx(ctx).With().
+		Str("owner_mxid", bot.OwnerMXID.String()).
+		Str("policy", string(cfg.OwnerDeactivationPolicy)).
+		Logger()
+	policy := cfg.OwnerDeactivationPolicy
+	fallbackOwner := getFallbackOwner()
+	if policy == OwnerDeactivationTransfer && fallbackOwner == "" {
+		log.Warn().Msg("No fallback owner configured, suspending bot of deactivated owner instead of transferring")
+		policy = OwnerDeactivationSuspend
+	}
+	switch policy {
+	case OwnerDeactivationTransfer:
+		if err := db.SetBotOwner(ctx, bot, fallbackOwner); err != nil {
+			return false, fmt.Errorf("failed to transfer bot of deactivated owner: %w", err)
+		}
+		auditSystem(ctx, AuditBotTransferred, bot.MXID, "owner %s was deactivated, transferred to %s", bot.OwnerMXID, fallbackOwner)
+		if err := notifyUser(ctx, fallbackOwner, ownerDeactivatedTransferNotice, bot.OwnerMXID, bot.MXID); err != nil {
+			log.Debug().Err(err).Msg("Failed to notify fallback owner about transferred bot")
+		}
+	case OwnerDeactivationSuspend:
+		if bot.SuspendedBy != "" {
+			return false, nil
+		} else if err := suspendBot(ctx, bot, cli.UserID); errors.Is(err, errSuspendLogoutFailed) {
+			log.Warn().Err(err).Msg("Suspended bot of deactivated owner, but failed to log out its devices")
+		} else if err != nil {
+			return false, fmt.Errorf("failed to suspend bot of deactivated owner: %w", err)
+		}
+		auditSystem(ctx, AuditBotSuspended, bot.MXID, "owner %s was deactivated", bot.OwnerMXID)
+	case OwnerDeactivationDeactivate:
+		if err := deactivateBotAccount(ctx, bot.MXID); err != nil {
+			return false, fmt.Errorf("failed to deactivate bot of deactivated owner: %w", err)
+		}
+		auditSystem(ctx, AuditBotDeactivated, bot.MXID, "owner %s was deactivated", bot.OwnerMXID)
+	}
+	return true, nil
+}
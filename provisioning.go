@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/id"
+)
+
+const provisioningPrefix = "/_botbot/v1"
+
+// Requests only have a few short fields, anything bigger isn't a valid request.
+const maxRequestBodySize = 64 * 1024
+
+// errCreateNeedsApproval is returned instead of filing a creation request, because approved bots are delivered
+// as a reply to the create command, which an API client can't receive.
+var errCreateNeedsApproval = &UserError{
+	StatusCode: http.StatusForbidden,
+	ErrCode:    "M_FORBIDDEN",
+	Message:    "Creating bots requires approval, use the `create` command in a direct chat with botbot instead",
+}
+
+type ReqCreateBot struct {
+	Username string `json:"username"`
+	Expires  string `json:"expires,omitempty"`
+	Purpose  string `json:"purpose,omitempty"`
+}
+
+type RespBot struct {
+	UserID      id.UserID                `json:"user_id"`
+	Owner       id.UserID                `json:"owner"`
+	OwnerRoom   id.RoomID                `json:"owner_room,omitempty"`
+	Role        BotRole                  `json:"role"`
+	Purpose     string                   `json:"purpose,omitempty"`
+	ExpiresAt   int64                    `json:"expires_at,omitempty"`
+	Deactivated bool                     `json:"deactivated"`
+	Suspended   bool                     `json:"suspended"`
+	Devices     []mautrix.RespDeviceInfo `json:"devices,omitempty"`
+}
+
+type RespListBots struct {
+	Bots []*RespBot `json:"bots"`
+}
+
+type RespBotCredentials struct {
+	BotCredentials
+	ExpiresAt int64    `json:"expires_at,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+func startProvisioningAPI(log zerolog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(provisioningPrefix+"/bots", provisioningHandler(log, handleBotsEndpoint))
+	mux.Handle(provisioningPrefix+"/bots/", provisioningHandler(log, handleBotEndpoint))
+	server := &http.Server{
+		Addr:              cfg.APIListenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Info().Str("address", cfg.APIListenAddress).Msg("Starting provisioning API")
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Error in provisioning API server")
+		}
+	}()
+	return server
+}
+
+type provisioningHandlerFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request)
+
+// The user is put in the context so that auditing and authorization work the same way as in commands.
+func provisioningHandler(baseLog zerolog.Logger, handler provisioningHandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := baseLog.With().
+			Str("action", "provisioning api request").
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Logger()
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := startRequest(log.WithContext(ctx), "provisioning api request",
+			attribute.String("http.method", r.Method),
+			attribute.String("http.target", r.URL.Path),
+		)
+		defer span.End()
+		log = *zerolog.Ctx(ctx)
+		w.Header().Set(requestIDHeader, getRequestID(ctx))
+		defer func() {
+			if err := recover(); err != nil {
+				log.Error().
+					Interface("error", err).
+					Bytes("stack", debug.Stack()).
+					Msg("Panic while processing provisioning API request")
+				setSpanError(ctx, nil, "panic")
+				writeJSON(w, http.StatusInternalServerError, &mautrix.RespError{ErrCode: "M_UNKNOWN", Err: "Internal error processing request"})
+			}
+		}()
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeJSON(w, http.StatusUnauthorized, &mautrix.RespError{ErrCode: "M_MISSING_TOKEN", Err: "Missing OpenID token"})
+			return
+		}
+		userID, err := validateOpenIDToken(ctx, token)
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to validate OpenID token")
+			writeJSON(w, http.StatusUnauthorized, &mautrix.RespError{ErrCode: "M_UNKNOWN_TOKEN", Err: "Invalid OpenID token"})
+			return
+		}
+		log = log.With().Str("user_id", userID.String()).Logger()
+		ctx = log.WithContext(ctx)
+		ctx = context.WithValue(ctx, contextKeyAPIUser, userID)
+		ctx = context.WithValue(ctx, contextKeyCommandAudit, &commandAudit{})
+		handler(ctx, w, r)
+	})
+}
+
+type respOpenIDUserInfo struct {
+	Sub id.UserID `json:"sub"`
+}
+
+func validateOpenIDToken(ctx context.Context, token string) (id.UserID, error) {
+	serverURL := cfg.OpenIDServerURL
+	if serverURL == "" {
+		serverURL = cfg.HomeserverURL
+	}
+	userInfoURL, err := url.Parse(strings.TrimSuffix(serverURL, "/") + "/_matrix/federation/v1/openid/userinfo")
+	if err != nil {
+		return "", fmt.Errorf("failed to parse OpenID server URL: %w", err)
+	}
+	userInfoURL.RawQuery = url.Values{"access_token": {token}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, userInfoURL.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare request: %w", err)
+	}
+	addRequestHeaders(ctx, req)
+	resp, err := cli.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var userInfo respOpenIDUserInfo
+	if err = json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	} else if _, homeserver, err := userInfo.Sub.Parse(); err != nil {
+		return "", fmt.Errorf("invalid user ID in response: %w", err)
+	} else if homeserver != cli.UserID.Homeserver() {
+		return "", fmt.Errorf("user %s is not on this homeserver", userInfo.Sub)
+	}
+	return userInfo.Sub, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+// writeError is the provisioning API equivalent of replyError.
+func writeError(ctx context.Context, w http.ResponseWriter, err error, message string) {
+	var userErr *UserError
+	if errors.As(err, &userErr) {
+		writeJSON(w, userErr.StatusCode, &mautrix.RespError{
+			ErrCode: userErr.ErrCode,
+			Err:     strings.ReplaceAll(userErr.Message, "´", "`"),
+		})
+		return
+	}
+	zerolog.Ctx(ctx).Err(err).Msg(message)
+	setSpanError(ctx, err, message)
+	auditCommandFailure(ctx, err, message)
+	writeJSON(w, http.StatusInternalServerError, &mautrix.RespError{ErrCode: "M_UNKNOWN", Err: message})
+}
+
+func makeRespBot(ctx context.Context, bot *Bot) (*RespBot, error) {
+	role, err := getUserBotRole(ctx, bot, getActor(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role of %s: %w", bot.MXID, err)
+	}
+	resp := &RespBot{
+		UserID:      bot.MXID,
+		Owner:       bot.OwnerMXID,
+		OwnerRoom:   bot.OwnerRoom,
+		Role:        role,
+		Purpose:     bot.Purpose,
+		Deactivated: bot.Deactivated,
+		Suspended:   bot.SuspendedBy != "",
+	}
+	if !bot.ExpiresAt.IsZero() {
+		resp.ExpiresAt = bot.ExpiresAt.UnixMilli()
+	}
+	return resp, nil
+}
+
+func handleBotsEndpoint(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		provisionList(ctx, w)
+	case http.MethodPost:
+		provisionCreate(ctx, w, r)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, &mautrix.RespError{ErrCode: "M_UNRECOGNIZED", Err: "Method not allowed"})
+	}
+}
+
+func handleBotEndpoint(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, provisioningPrefix+"/bots/"), "/")
+	switch {
+	case len(path) == 1 && r.Method == http.MethodGet:
+		provisionShow(ctx, w, path[0])
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		provisionDelete(ctx, w, path[0])
+	case len(path) == 2 && path[1] == "reset" && r.Method == http.MethodPost:
+		provisionReset(ctx, w, path[0])
+	default:
+		writeJSON(w, http.StatusNotFound, &mautrix.RespError{ErrCode: "M_UNRECOGNIZED", Err: "Unrecognized endpoint"})
+	}
+}
+
+func provisionList(ctx context.Context, w http.ResponseWriter) {
+	bots, err := getVisibleBots(ctx, getActor(ctx))
+	if err != nil {
+		writeError(ctx, w, err, "Failed to get bot list")
+		return
+	}
+	resp := &RespListBots{Bots: make([]*RespBot, len(bots))}
+	for i := range bots {
+		if resp.Bots[i], err = makeRespBot(ctx, &bots[i]); err != nil {
+			writeError(ctx, w, err, "Failed to get bot list")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func provisionShow(ctx context.Context, w http.ResponseWriter, username string) {
+	bot, err := authorizeBot(ctx, getActor(ctx), username, RoleViewer, true)
+	if err != nil {
+		writeError(ctx, w, err, "Failed to check your access to the bot")
+		return
+	}
+	resp, err := makeRespBot(ctx, bot)
+	if err != nil {
+		writeError(ctx, w, err, "Failed to get bot info")
+		return
+	}
+	devices, err := synadm.ListDevices(ctx, bot.MXID)
+	if err != nil {
+		writeError(ctx, w, err, "Failed to get bot device info")
+		return
+	}
+	for _, device := range devices.Devices {
+		resp.Devices = append(resp.Devices, device.RespDeviceInfo)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func provisionCreate(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var req ReqCreateBot
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, &mautrix.RespError{ErrCode: "M_NOT_JSON", Err: "Failed to parse request body"})
+		return
+	} else if req.Username == "" {
+		writeJSON(w, http.StatusBadRequest, &mautrix.RespError{ErrCode: "M_MISSING_PARAM", Err: "Missing username"})
+		return
+	} else if cfg.CreateApproval {
+		writeError(ctx, w, errCreateNeedsApproval, "")
+		return
+	}
+	params := &NewBotParams{Username: req.Username, Purpose: strings.TrimSpace(req.Purpose)}
+	if req.Expires != "" {
+		var err error
+		params.Lifetime, err = parseDuration(req.Expires)
+		if err != nil || params.Lifetime <= 0 {
+			writeJSON(w, http.StatusBadRequest, &mautrix.RespError{ErrCode: "M_INVALID_PARAM", Err: "Invalid bot lifetime, use a duration like `12h` or `7d`"})
+			return
+		}
+	}
+	if cfg.CreateRequirePurpose && params.Purpose == "" {
+		writeJSON(w, http.StatusBadRequest, &mautrix.RespError{ErrCode: "M_MISSING_PARAM", Err: "The purpose of the bot is required"})
+		return
+	}
+	created, err := registerNewBot(ctx, getActor(ctx), params)
+	if err != nil {
+		writeError(ctx, w, err, "Failed to create bot")
+		return
+	}
+	resp := &RespBotCredentials{
+		BotCredentials: BotCredentials{
+			HomeserverURL: getHomeserverURLForCredentials(),
+			UserID:        created.Device.UserID,
+			DeviceID:      created.Device.DeviceID,
+			AccessToken:   created.Device.AccessToken,
+		},
+		Warnings: created.Warnings,
+	}
+	if !created.ExpiresAt.IsZero() {
+		resp.ExpiresAt = created.ExpiresAt.UnixMilli()
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func provisionReset(ctx context.Context, w http.ResponseWriter, username string) {
+	bot, err := authorizeBot(ctx, getActor(ctx), username, RoleMaintainer, false)
+	if err != nil {
+		writeError(ctx, w, err, "Failed to check your access to the bot")
+		return
+	}
+	device, err := resetBot(ctx, bot)
+	if err != nil {
+		writeError(ctx, w, err, "Failed to reset bot")
+		return
+	}
+	writeJSON(w, http.StatusOK, &RespBotCredentials{
+		BotCredentials: BotCredentials{
+			HomeserverURL: getHomeserverURLForCredentials(),
+			UserID:        device.UserID,
+			DeviceID:      device.DeviceID,
+			AccessToken:   device.AccessToken,
+		},
+	})
+}
+
+func provisionDelete(ctx context.Context, w http.ResponseWriter, username string) {
+	_, err := authorizeBot(ctx, getActor(ctx), username, RoleOwner, false)
+	if err != nil {
+		writeError(ctx, w, err, "Failed to check your access to the bot")
+		return
+	}
+	writeJSON(w, http.StatusNotImplemented, &mautrix.RespError{ErrCode: "M_UNRECOGNIZED", Err: "Deleting bots is not yet supported"})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/id"
+)
+
+func TestProvisionCreateWithExpiry(t *testing.T) {
+	ctx, _ := setupTestEnv(t)
+	owner := id.NewUserID("alice", testServerName)
+
+	body := strings.NewReader(`{"username": "testbot", "expires": "7d"}`)
+	req := httptest.NewRequest(http.MethodPost, provisioningPrefix+"/bots", body)
+	// The fake homeserver treats the OpenID token as the user ID
+	req.Header.Set("Authorization", "Bearer "+owner.String())
+	w := httptest.NewRecorder()
+	provisioningHandler(zerolog.Nop(), handleBotsEndpoint).ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var resp RespBotCredentials
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	botID := id.NewUserID("testbot", testServerName)
+	if resp.UserID != botID || resp.AccessToken == "" {
+		t.Errorf("Unexpected credentials in response: %+v", resp.BotCredentials)
+	}
+	if resp.ExpiresAt == 0 {
+		t.Errorf("Response doesn't have an expiry (warnings: %v)", resp.Warnings)
+	} else if until := time.Until(time.UnixMilli(resp.ExpiresAt)); until < 6*24*time.Hour || until > 7*24*time.Hour {
+		t.Errorf("Unexpected expiry %s from now", until)
+	}
+
+	bot, err := db.GetBot(ctx, botID)
+	if err != nil || bot == nil {
+		t.Fatalf("Bot wasn't stored in database: %v", err)
+	} else if bot.OwnerMXID != owner {
+		t.Errorf("Expected owner %s, got %s", owner, bot.OwnerMXID)
+	}
+	for _, action := range []JobAction{JobActionExpireBot, JobActionBotExpiryWarning} {
+		job, err := db.GetJob(ctx, botExpiryJobKey(action, botID))
+		if err != nil || job == nil {
+			t.Fatalf("%s job wasn't scheduled: %v", action, err)
+		}
+		var payload BotExpiryPayload
+		if err = json.Unmarshal(job.Payload, &payload); err != nil {
+			t.Fatalf("Failed to parse %s payload: %v", action, err)
+		} else if payload.BotMXID != botID || payload.RoomID != "" {
+			t.Errorf("Unexpected %s payload %+v", action, payload)
+		}
+	}
+}
+
+func TestProvisionCreateBodyTooLarge(t *testing.T) {
+	setupTestEnv(t)
+	owner := id.NewUserID("alice", testServerName)
+
+	body := strings.NewReader(`{"username": "testbot", "purpose": "` + strings.Repeat("a", maxRequestBodySize) + `"}`)
+	req := httptest.NewRequest(http.MethodPost, provisioningPrefix+"/bots", body)
+	req.Header.Set("Authorization", "Bearer "+owner.String())
+	w := httptest.NewRecorder()
+	provisioningHandler(zerolog.Nop(), handleBotsEndpoint).ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/synapseadmin"
+	"maunium.net/go/mautrix/util"
+)
+
+const reconcileJobKey = "reconcile"
+
+const botNewDeviceAlert = `New login detected on your bot ´%s´:
+
+* Device ID: ´%s´
+* Display name: %s
+* Last seen from: %s
+
+If this wasn't you, %s`
+
+const botInactiveWarning = "Your bot ´%s´ hasn't been seen for %s. If you don't need it anymore, please let an admin know so it can be deactivated."
+const botInactiveDeactivateWarning = botInactiveWarning + " It will be deactivated automatically if it's still inactive in %s."
+const botInactiveDeactivated = "Your bot ´%s´ hasn't been seen for %s and was deactivated."
+
+func ensureReconcileJob(ctx context.Context) error {
+	if cfg.ReconcileInterval <= 0 {
+		return cancelJob(ctx, reconcileJobKey)
+	}
+	job, err := db.GetJob(ctx, reconcileJobKey)
+	if err != nil {
+		return err
+	} else if job != nil {
+		return nil
+	}
+	return scheduleJob(ctx, reconcileJobKey, JobActionReconcile, struct{}{}, time.Now().Add(1*time.Minute))
+}
+
+// Errors with individual bots are only logged, so that one broken bot doesn't stop the whole job.
+func runReconcileJob(ctx context.Context, job *Job) error {
+	log := zerolog.Ctx(ctx)
+	bots, err := db.GetActiveBots(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get bots: %w", err)
+	}
+	log.Debug().Int("bot_count", len(bots)).Msg("Reconciling bots")
+	deactivatedOwners := make(map[id.UserID]bool)
+	for i := range bots {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		bot := &bots[i]
+		botLog := log.With().Str("bot_mxid", bot.MXID.String()).Logger()
+		err = reconcileBot(botLog.WithContext(ctx), bot, deactivatedOwners)
+		if err != nil {
+			botLog.Err(err).Msg("Failed to reconcile bot")
+		}
+	}
+	if cfg.ReconcileInterval > 0 {
+		err = scheduleJob(ctx, job.Key, JobActionReconcile, struct{}{}, time.Now().Add(cfg.ReconcileInterval))
+		if err != nil {
+			return fmt.Errorf("failed to schedule next reconcile: %w", err)
+		}
+	}
+	return nil
+}
+
+func reconcileBot(ctx context.Context, bot *Bot, deactivatedOwners map[id.UserID]bool) error {
+	if changed, err := checkOwnerDeactivated(ctx, bot, deactivatedOwners); err != nil || changed {
+		return err
+	} else if bot.SuspendedBy != "" {
+		// Suspended bots are locked and have no devices, there's nothing to check until they're resumed
+		return nil
+	}
+	devices, err := synadm.ListDevices(ctx, bot.MXID)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+	err = checkBotDevices(ctx, bot, devices.Devices)
+	if err != nil {
+		return err
+	}
+	return checkBotInactivity(ctx, bot, devices.Devices)
+}
+
+func checkBotDevices(ctx context.Context, bot *Bot, devices []synapseadmin.DeviceInfo) error {
+	log := zerolog.Ctx(ctx)
+	knownDevices, err := db.GetBotDevices(ctx, bot.MXID)
+	if err != nil {
+		return fmt.Errorf("failed to get known devices: %w", err)
+	}
+	// The first check only records existing devices, as there's no previous snapshot to compare to
+	isBaseline := bot.DevicesCheckedAt.IsZero()
+	for _, device := range devices {
+		if _, known := knownDevices[device.DeviceID]; known {
+			delete(knownDevices, device.DeviceID)
+			continue
+		}
+		err = db.AddBotDevice(ctx, &BotDevice{
+			BotMXID:   bot.MXID,
+			DeviceID:  device.DeviceID,
+			Baseline:  isBaseline,
+			FirstSeen: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store new device: %w", err)
+		} else if isBaseline {
+			continue
+		}
+		auditSystem(ctx, AuditUnknownDevice, bot.MXID, "device %s last seen from %s", device.DeviceID, orUnknown(device.LastSeenIP))
+		revokeInstructions := fmt.Sprintf("use `revoke %s %s` to log it out.", bot.MXID.Localpart(), device.DeviceID)
+		// Only the latest alert can be answered with a plain revoke, so don't offer it while another offer is pending
+		canOfferRevoke := getRevokeOffer(bot.OwnerMXID) == nil
+		if canOfferRevoke {
+			revokeInstructions = fmt.Sprintf("reply `revoke` within %s to log it out, or ", util.FormatDuration(revokeOfferTimeout)) + revokeInstructions
+		}
+		err = notifyUser(
+			ctx, bot.OwnerMXID, botNewDeviceAlert,
+			bot.MXID, device.DeviceID, orUnknown(device.DisplayName), orUnknown(device.LastSeenIP), revokeInstructions,
+		)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to alert owner about new device")
+		} else if canOfferRevoke {
+			offerRevokeDevice(bot.OwnerMXID, bot.MXID, device.DeviceID)
+		}
+	}
+	for deviceID := range knownDevices {
+		if err = db.DeleteBotDevice(ctx, bot.MXID, deviceID); err != nil {
+			return fmt.Errorf("failed to remove deleted device: %w", err)
+		}
+	}
+	return db.SetBotDevicesChecked(ctx, bot.MXID, time.Now())
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+func getBotLastSeen(ctx context.Context, bot *Bot, devices []synapseadmin.DeviceInfo) (time.Time, error) {
+	var lastSeenTS int64
+	for _, device := range devices {
+		if device.LastSeenTS > lastSeenTS {
+			lastSeenTS = device.LastSeenTS
+		}
+	}
+	if lastSeenTS > 0 {
+		return time.UnixMilli(lastSeenTS), nil
+	}
+	userInfo, err := synadm.GetUserInfo(ctx, bot.MXID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get user info: %w", err)
+	}
+	return userInfo.CreationTS.Time, nil
+}
+
+// Bots are only deactivated after the owner has been warned, which gives them at least the difference
+// between the warning and deactivation periods to react.
+func checkBotInactivity(ctx context.Context, bot *Bot, devices []synapseadmin.DeviceInfo) error {
+	if cfg.InactivityWarningPeriod <= 0 {
+		return nil
+	}
+	lastSeen, err := getBotLastSeen(ctx, bot, devices)
+	if err != nil {
+		return err
+	}
+	inactiveFor := time.Since(lastSeen)
+	inactiveForStr := util.FormatDuration(inactiveFor.Truncate(util.Day))
+	log := zerolog.Ctx(ctx).With().Time("last_seen", lastSeen).Logger()
+	gracePeriod := cfg.InactivityDeactivatePeriod - cfg.InactivityWarningPeriod
+	if inactiveFor < cfg.InactivityWarningPeriod {
+		if !bot.InactivityNotifiedAt.IsZero() {
+			log.Debug().Msg("Bot is active again, clearing inactivity notification")
+			return db.SetBotInactivityNotified(ctx, bot.MXID, time.Time{})
+		}
+		return nil
+	} else if bot.InactivityNotifiedAt.IsZero() {
+		log.Debug().Msg("Notifying owner about inactive bot")
+		if cfg.InactivityDeactivatePeriod > 0 {
+			deactivateIn := cfg.InactivityDeactivatePeriod - inactiveFor
+			if deactivateIn < gracePeriod {
+				deactivateIn = gracePeriod
+			}
+			err = notifyUser(ctx, bot.OwnerMXID, botInactiveDeactivateWarning, bot.MXID, inactiveForStr, util.FormatDuration(deactivateIn.Truncate(time.Hour)))
+		} else {
+			err = notifyUser(ctx, bot.OwnerMXID, botInactiveWarning, bot.MXID, inactiveForStr)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to notify owner about inactive bot: %w", err)
+		}
+		return db.SetBotInactivityNotified(ctx, bot.MXID, time.Now())
+	} else if cfg.InactivityDeactivatePeriod > 0 && inactiveFor >= cfg.InactivityDeactivatePeriod &&
+		time.Since(bot.InactivityNotifiedAt) >= gracePeriod {
+		log.Info().Time("notified_at", bot.InactivityNotifiedAt).Msg("Deactivating inactive bot")
+		if err = deactivateBotAccount(ctx, bot.MXID); err != nil {
+			return err
+		}
+		auditSystem(ctx, AuditBotDeactivated, bot.MXID, "inactive for %s", inactiveForStr)
+		err = notifyUser(ctx, bot.OwnerMXID, botInactiveDeactivated, bot.MXID, inactiveForStr)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to notify owner about deactivated inactive bot")
+		}
+	}
+	return nil
+}
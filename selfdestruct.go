@@ -2,49 +2,207 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
+	"maunium.net/go/mautrix/util"
 )
 
-func restartSelfDestruct() {
-	log := globalLog.With().Str("action", "restart self-destruct").Logger()
-	ctx := log.WithContext(context.Background())
-	evts, err := db.GetSelfDestructingEvents(ctx)
+type SelfDestructOptions struct {
+	Delay time.Duration
+	// OnRead makes the message self-destruct when the user reads it. Delay is still used as a fallback.
+	OnRead bool
+}
+
+func (sdo *SelfDestructOptions) String() string {
+	if sdo.OnRead {
+		return "after you read it"
+	} else if cfg.SelfDestructAfterRead {
+		return "in " + util.FormatDuration(sdo.Delay) + " or shortly after you read it"
+	}
+	return "in " + util.FormatDuration(sdo.Delay)
+}
+
+func parseSelfDestructOptions(ctx context.Context, value string) (*SelfDestructOptions, bool) {
+	if strings.ToLower(value) == "read" {
+		return &SelfDestructOptions{Delay: cfg.MaxSelfDestructDelay, OnRead: true}, true
+	}
+	delay, err := parseDuration(value)
 	if err != nil {
-		log.Err(err).Msg("Failed to get self-destructing events from database")
-		return
+		reply(ctx, "Invalid self-destruct delay `%s`. Use a duration like `30s` or `10m`, or `read` to self-destruct after reading.", value)
+		return nil, false
+	} else if delay < cfg.MinSelfDestructDelay || delay > cfg.MaxSelfDestructDelay {
+		reply(
+			ctx, "The self-destruct delay must be between %s and %s",
+			util.FormatDuration(cfg.MinSelfDestructDelay), util.FormatDuration(cfg.MaxSelfDestructDelay),
+		)
+		return nil, false
+	}
+	return &SelfDestructOptions{Delay: delay}, true
+}
+
+func getSelfDestructOptions(ctx context.Context, flagValue string) (*SelfDestructOptions, bool) {
+	if flagValue != "" {
+		return parseSelfDestructOptions(ctx, flagValue)
+	}
+	user, err := db.GetUser(ctx, getEvent(ctx).Sender)
+	if err != nil {
+		replyErr(ctx, err, "Failed to get your preferences")
+		return nil, false
+	} else if user.SelfDestructOnRead {
+		return &SelfDestructOptions{Delay: cfg.MaxSelfDestructDelay, OnRead: true}, true
+	} else if user.SelfDestructDelay > 0 {
+		return &SelfDestructOptions{Delay: clampSelfDestructDelay(user.SelfDestructDelay)}, true
 	}
-	for _, evt := range evts {
-		log.Debug().
-			Str("event_id", evt.EventID.String()).
-			Time("delete_at", evt.DeleteAt).
-			Msg("Restarting self-destruct timer")
-		go doSelfDestruct(ctx, evt.RoomID, evt.EventID, evt.DeleteAt)
+	return &SelfDestructOptions{Delay: clampSelfDestructDelay(cfg.SelfDestructDelay)}, true
+}
+
+// clampSelfDestructDelay makes sure stored preferences still respect the bounds if the config changes.
+func clampSelfDestructDelay(delay time.Duration) time.Duration {
+	if delay < cfg.MinSelfDestructDelay {
+		return cfg.MinSelfDestructDelay
+	} else if delay > cfg.MaxSelfDestructDelay {
+		return cfg.MaxSelfDestructDelay
 	}
+	return delay
+}
+
+type RedactEventPayload struct {
+	RoomID  id.RoomID  `json:"room_id"`
+	EventID id.EventID `json:"event_id"`
+	// Timestamp is zero for jobs migrated from self_destructing_events, the event is fetched for those instead.
+	Timestamp    int64 `json:"timestamp,omitempty"`
+	RedactOnRead bool  `json:"redact_on_read"`
+}
+
+func redactEventJobKey(eventID id.EventID) string {
+	return fmt.Sprintf("%s:%s", JobActionRedactEvent, eventID)
 }
 
-func selfDestruct(ctx context.Context, eventID id.EventID, after time.Duration) {
+func selfDestruct(ctx context.Context, eventID id.EventID, opts *SelfDestructOptions) {
 	roomID := getEvent(ctx).RoomID
-	deleteAt := time.Now().Add(after)
-	err := db.SetSelfDestruct(ctx, roomID, eventID, deleteAt)
+	err := scheduleRoomJob(ctx, redactEventJobKey(eventID), JobActionRedactEvent, roomID, &RedactEventPayload{
+		RoomID:       roomID,
+		EventID:      eventID,
+		Timestamp:    time.Now().UnixMilli(),
+		RedactOnRead: opts.OnRead || cfg.SelfDestructAfterRead,
+	}, time.Now().Add(opts.Delay))
 	if err != nil {
-		zerolog.Ctx(ctx).Err(err).Msg("Failed to mark event as self-destructing in database")
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to schedule event self-destruct")
 	}
-	go doSelfDestruct(ctx, roomID, eventID, deleteAt)
 }
 
-func doSelfDestruct(ctx context.Context, roomID id.RoomID, eventID id.EventID, at time.Time) {
-	time.Sleep(time.Until(at))
-	log := zerolog.Ctx(ctx).With().Str("target_event_id", eventID.String()).Logger()
-	if _, err := cli.RedactEvent(roomID, eventID); err != nil {
-		log.Err(err).Msg("Failed to self-destruct message")
-	} else {
-		log.Debug().Msg("Event self-destructed")
-		err = db.DoneSelfDestruct(ctx, eventID)
+func runRedactEventJob(ctx context.Context, job *Job) error {
+	var payload RedactEventPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+	_, err := cli.RedactEvent(payload.RoomID, payload.EventID)
+	if err != nil {
+		return fmt.Errorf("failed to redact event: %w", err)
+	}
+	zerolog.Ctx(ctx).Debug().Str("target_event_id", payload.EventID.String()).Msg("Event self-destructed")
+	return nil
+}
+
+func handleReceipt(_ mautrix.EventSource, evt *event.Event) {
+	log := globalLog.With().
+		Str("room_id", evt.RoomID.String()).
+		Str("action", "read receipt").
+		Logger()
+	ctx, span := startRequest(log.WithContext(context.Background()), "handle read receipt")
+	defer span.End()
+	log = *zerolog.Ctx(ctx)
+	var readEventIDs []id.EventID
+	for eventID, receipts := range *evt.Content.AsReceipt() {
+		for userID := range receipts[event.ReceiptTypeRead] {
+			if userID != cli.UserID {
+				readEventIDs = append(readEventIDs, eventID)
+				break
+			}
+		}
+	}
+	if len(readEventIDs) == 0 {
+		return
+	}
+	jobs, err := db.GetRoomJobs(ctx, evt.RoomID, JobActionRedactEvent)
+	if err != nil {
+		log.Err(err).Msg("Failed to get pending redactions")
+		return
+	} else if len(jobs) == 0 {
+		return
+	}
+	readTimestamps := make(map[id.EventID]int64, len(readEventIDs))
+	for _, job := range jobs {
+		var target RedactEventPayload
+		if err = json.Unmarshal(job.Payload, &target); err != nil {
+			log.Warn().Err(err).Str("job_key", job.Key).Msg("Failed to parse redaction job payload")
+			continue
+		} else if !target.RedactOnRead {
+			continue
+		}
+		for _, readEventID := range readEventIDs {
+			if receiptCoversEvent(ctx, evt.RoomID, readEventID, &target, readTimestamps) {
+				selfDestructAfterRead(ctx, job, &target, readEventID)
+				break
+			}
+		}
+	}
+}
+
+func selfDestructAfterRead(ctx context.Context, job *Job, target *RedactEventPayload, readEventID id.EventID) {
+	log := zerolog.Ctx(ctx).With().
+		Str("target_event_id", target.EventID.String()).
+		Str("read_event_id", readEventID.String()).
+		Logger()
+	deleteAt := time.Now().Add(cfg.SelfDestructReadGrace)
+	if job.RunAt.Before(deleteAt) {
+		deleteAt = job.RunAt
+	}
+	target.RedactOnRead = false
+	err := scheduleRoomJob(ctx, job.Key, JobActionRedactEvent, target.RoomID, target, deleteAt)
+	if err != nil {
+		log.Err(err).Msg("Failed to update self-destruct deadline after read receipt")
+		return
+	}
+	log.Debug().Time("delete_at", deleteAt).Msg("Event was read, moving self-destruct deadline")
+}
+
+// Receipts are only sent in direct chats where the only other member is the owner of the message,
+// so it's enough to check that the read event isn't older than the target.
+func receiptCoversEvent(ctx context.Context, roomID id.RoomID, readEventID id.EventID, target *RedactEventPayload, readTimestamps map[id.EventID]int64) bool {
+	if readEventID == target.EventID {
+		return true
+	}
+	log := zerolog.Ctx(ctx)
+	readTS, ok := readTimestamps[readEventID]
+	if !ok {
+		readEvt, err := cli.GetEvent(roomID, readEventID)
+		if err != nil {
+			log.Warn().Err(err).Str("read_event_id", readEventID.String()).Msg("Failed to get read event")
+		} else {
+			readTS = readEvt.Timestamp
+		}
+		// Failures are cached too to avoid retrying the same request for every job
+		readTimestamps[readEventID] = readTS
+	}
+	if readTS == 0 {
+		return false
+	}
+	targetTS := target.Timestamp
+	if targetTS == 0 {
+		targetEvt, err := cli.GetEvent(roomID, target.EventID)
 		if err != nil {
-			log.Warn().Err(err).Msg("Failed to remove self-destruct marker from database")
+			log.Warn().Err(err).Str("target_event_id", target.EventID.String()).Msg("Failed to get self-destructing event")
+			return false
 		}
+		targetTS = targetEvt.Timestamp
 	}
+	return readTS >= targetTS
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func getTeamPowerLevels(roomID id.RoomID) (*event.PowerLevelsEventContent, error) {
+	levels := cli.StateStore.GetPowerLevels(roomID)
+	if levels != nil {
+		return levels, nil
+	}
+	levels = &event.PowerLevelsEventContent{}
+	err := cli.StateEvent(roomID, event.StatePowerLevels, "", levels)
+	if err != nil {
+		return nil, err
+	}
+	cli.StateStore.SetPowerLevels(roomID, levels)
+	return levels, nil
+}
+
+func isTeamMember(roomID id.RoomID, userID id.UserID) (bool, error) {
+	if cli.StateStore.IsInRoom(roomID, userID) {
+		return true, nil
+	}
+	var member event.MemberEventContent
+	err := cli.StateEvent(roomID, event.StateMember, userID.String(), &member)
+	if errors.Is(err, mautrix.MNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	cli.StateStore.SetMember(roomID, userID, &member)
+	return member.Membership == event.MembershipJoin, nil
+}
+
+func getTeamRole(roomID id.RoomID, userID id.UserID) (BotRole, error) {
+	if isMember, err := isTeamMember(roomID, userID); err != nil {
+		return RoleNone, fmt.Errorf("failed to check membership: %w", err)
+	} else if !isMember {
+		return RoleNone, nil
+	}
+	levels, err := getTeamPowerLevels(roomID)
+	if err != nil {
+		return RoleNone, fmt.Errorf("failed to get power levels: %w", err)
+	}
+	level := levels.GetUserLevel(userID)
+	if level >= cfg.TeamOwnerPowerLevel {
+		return RoleOwner, nil
+	} else if level >= cfg.TeamMaintainerPowerLevel {
+		return RoleMaintainer, nil
+	}
+	return RoleViewer, nil
+}
+
+func getUserBotRole(ctx context.Context, bot *Bot, userID id.UserID) (BotRole, error) {
+	role, err := db.GetBotRole(ctx, bot.MXID, userID)
+	if err != nil || bot.OwnerRoom == "" || role == RoleOwner {
+		return role, err
+	}
+	teamRole, err := getTeamRole(bot.OwnerRoom, userID)
+	if err != nil {
+		return role, fmt.Errorf("failed to get role in team room: %w", err)
+	} else if teamRole.AtLeast(role) {
+		role = teamRole
+	}
+	return role, nil
+}
+
+func getTeamBotsOfUser(ctx context.Context, userID id.UserID) ([]Bot, error) {
+	rooms, err := db.GetTeamRooms(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get team rooms: %w", err)
+	}
+	var bots []Bot
+	for _, roomID := range rooms {
+		if isMember, err := isTeamMember(roomID, userID); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("team_room_id", roomID.String()).Msg("Failed to check team room membership")
+		} else if isMember {
+			teamBots, err := db.GetTeamBots(ctx, roomID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get team bots: %w", err)
+			}
+			bots = append(bots, teamBots...)
+		}
+	}
+	return bots, nil
+}
+
+// The direct chat rules don't apply to team rooms and the admin room, and commands sent in them are ignored.
+func isGroupRoom(ctx context.Context, roomID id.RoomID) (bool, error) {
+	if cfg.AdminRoom != "" && roomID == cfg.AdminRoom {
+		return true, nil
+	}
+	return db.IsTeamRoom(ctx, roomID)
+}
+
+const teamInviteTimeout = 10 * time.Minute
+
+type expectedTeamInvite struct {
+	Inviter   id.UserID
+	ExpiresAt time.Time
+}
+
+var expectedTeamInvites = make(map[id.RoomID]expectedTeamInvite)
+var expectedTeamInvitesLock sync.Mutex
+
+// The room only becomes a team room once the transfer succeeds, so until then invites to it are accepted
+// only if they're expected.
+func expectTeamInvite(roomID id.RoomID, inviter id.UserID) {
+	expectedTeamInvitesLock.Lock()
+	expectedTeamInvites[roomID] = expectedTeamInvite{Inviter: inviter, ExpiresAt: time.Now().Add(teamInviteTimeout)}
+	expectedTeamInvitesLock.Unlock()
+}
+
+func popExpectedTeamInvite(roomID id.RoomID, inviter id.UserID) bool {
+	expectedTeamInvitesLock.Lock()
+	defer expectedTeamInvitesLock.Unlock()
+	expected, ok := expectedTeamInvites[roomID]
+	if !ok || expected.Inviter != inviter {
+		return false
+	}
+	delete(expectedTeamInvites, roomID)
+	return time.Now().Before(expected.ExpiresAt)
+}
+
+// joinGroupRoom accepts an invite to a team room or the admin room without the direct chat checks.
+func joinGroupRoom(ctx context.Context, roomID id.RoomID) {
+	_, err := cli.JoinRoomByID(roomID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to join group room")
+	} else {
+		zerolog.Ctx(ctx).Debug().Msg("Joined group room")
+	}
+}
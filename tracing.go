@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"maunium.net/go/mautrix/util"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// tracer uses the global no-op tracer provider until initTracing is called.
+var tracer = otel.Tracer("github.com/beeper/botbot")
+
+// The function returned by initTracing flushes pending spans and should be called before exiting.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(cfg.OTLPEndpoint), otlptracehttp.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "botbot"),
+			attribute.String("service.version", Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+func newRequestID() string {
+	return util.RandomString(16)
+}
+
+func getRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKeyRequestID).(string)
+	return requestID
+}
+
+// The caller of startRequest must end the returned span.
+func startRequest(ctx context.Context, spanName string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	requestID := newRequestID()
+	attrs = append(attrs, attribute.String("botbot.request_id", requestID))
+	ctx, span := tracer.Start(ctx, spanName, trace.WithAttributes(attrs...))
+	logCtx := zerolog.Ctx(ctx).With().Str("request_id", requestID)
+	if spanCtx := span.SpanContext(); spanCtx.HasTraceID() {
+		logCtx = logCtx.Str("trace_id", spanCtx.TraceID().String())
+	}
+	ctx = context.WithValue(ctx, contextKeyRequestID, requestID)
+	return logCtx.Logger().WithContext(ctx), span
+}
+
+func setSpanError(ctx context.Context, err error, description string) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetStatus(codes.Error, description)
+}
+
+// detachContext is for background work that outlives the request, so it isn't canceled with ctx.
+func detachContext(ctx context.Context) context.Context {
+	detached := zerolog.Ctx(ctx).WithContext(context.Background())
+	if requestID := getRequestID(ctx); requestID != "" {
+		detached = context.WithValue(detached, contextKeyRequestID, requestID)
+	}
+	return trace.ContextWithSpanContext(detached, trace.SpanContextFromContext(ctx))
+}
+
+func addRequestHeaders(ctx context.Context, req *http.Request) {
+	if requestID := getRequestID(ctx); requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
@@ -0,0 +1,9 @@
+-- v2: Add self-destruct preferences
+CREATE TABLE users (
+    mxid                  TEXT    NOT NULL PRIMARY KEY,
+    -- Milliseconds, NULL means the default from the config is used
+    self_destruct_delay   BIGINT,
+    self_destruct_on_read BOOLEAN NOT NULL DEFAULT false
+);
+
+ALTER TABLE self_destructing_events ADD COLUMN redact_on_read BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- v3: Store self-destruct retry state
+ALTER TABLE self_destructing_events ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE self_destructing_events ADD COLUMN last_error TEXT;
@@ -0,0 +1,25 @@
+-- v4: Generalize self-destructing events into scheduled jobs
+CREATE TABLE scheduled_jobs (
+    job_key    TEXT    NOT NULL PRIMARY KEY,
+    action     TEXT    NOT NULL,
+    payload    TEXT    NOT NULL,
+    run_at     BIGINT  NOT NULL,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    room_id    TEXT
+);
+
+CREATE INDEX scheduled_jobs_room_idx ON scheduled_jobs (room_id, action);
+
+INSERT INTO scheduled_jobs (job_key, action, payload, run_at, attempts, last_error, room_id)
+SELECT
+    'redact_event:' || event_id,
+    'redact_event',
+    '{"room_id":"' || room_id || '","event_id":"' || event_id || '","redact_on_read":' || (CASE WHEN redact_on_read THEN 'true' ELSE 'false' END) || '}',
+    delete_at,
+    attempts,
+    last_error,
+    room_id
+FROM self_destructing_events;
+
+DROP TABLE self_destructing_events;
@@ -0,0 +1,3 @@
+-- v5: Add expiry and deactivation state to bots
+ALTER TABLE bots ADD COLUMN expires_at BIGINT;
+ALTER TABLE bots ADD COLUMN deactivated BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- v6: Store management rooms and bot inactivity notification state
+ALTER TABLE users ADD COLUMN management_room TEXT;
+ALTER TABLE bots ADD COLUMN inactivity_notified_at BIGINT;
@@ -0,0 +1,13 @@
+-- v7: Store known bot devices to detect new logins
+CREATE TABLE bot_devices (
+    bot_mxid          TEXT    NOT NULL,
+    device_id         TEXT    NOT NULL,
+    created_by_botbot BOOLEAN NOT NULL,
+    baseline          BOOLEAN NOT NULL,
+    first_seen        BIGINT  NOT NULL,
+
+    PRIMARY KEY (bot_mxid, device_id),
+    CONSTRAINT bot_devices_bot_fkey FOREIGN KEY (bot_mxid) REFERENCES bots (mxid) ON DELETE CASCADE
+);
+
+ALTER TABLE bots ADD COLUMN devices_checked_at BIGINT;
@@ -0,0 +1,2 @@
+-- v8: Add digest preference
+ALTER TABLE users ADD COLUMN digest_interval TEXT NOT NULL DEFAULT '';
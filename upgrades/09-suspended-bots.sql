@@ -0,0 +1,3 @@
+-- v9: Add suspended state for bots
+-- NULL means the bot isn't suspended
+ALTER TABLE bots ADD COLUMN suspended_by TEXT;
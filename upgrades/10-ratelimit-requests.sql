@@ -0,0 +1,9 @@
+-- v10: Store pending ratelimit override requests
+CREATE TABLE ratelimit_requests (
+    bot_mxid      TEXT   NOT NULL PRIMARY KEY,
+    requested_by  TEXT   NOT NULL,
+    justification TEXT   NOT NULL,
+    requested_at  BIGINT NOT NULL,
+
+    CONSTRAINT ratelimit_requests_bot_fkey FOREIGN KEY (bot_mxid) REFERENCES bots (mxid) ON DELETE CASCADE
+);
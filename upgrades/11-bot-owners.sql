@@ -0,0 +1,12 @@
+-- v11: Allow bots to have multiple owners with different roles
+CREATE TABLE bot_owners (
+    bot_mxid  TEXT NOT NULL,
+    user_mxid TEXT NOT NULL,
+    -- owner, maintainer or viewer
+    role      TEXT NOT NULL,
+
+    PRIMARY KEY (bot_mxid, user_mxid),
+    CONSTRAINT bot_owners_bot_fkey FOREIGN KEY (bot_mxid) REFERENCES bots (mxid) ON DELETE CASCADE
+);
+
+INSERT INTO bot_owners (bot_mxid, user_mxid, role) SELECT mxid, owner_mxid, 'owner' FROM bots;
@@ -0,0 +1,9 @@
+-- v12: Allow bots to be owned by team rooms
+CREATE TABLE team_rooms (
+    room_id  TEXT   NOT NULL PRIMARY KEY,
+    added_by TEXT   NOT NULL,
+    added_at BIGINT NOT NULL
+);
+
+-- NULL means the bot is only owned by users in bot_owners
+ALTER TABLE bots ADD COLUMN owner_room TEXT;
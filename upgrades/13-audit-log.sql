@@ -0,0 +1,19 @@
+-- v13: Add persistent audit log
+CREATE TABLE audit_log (
+-- only: postgres
+    id        BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+-- only: sqlite
+    id        INTEGER PRIMARY KEY,
+    timestamp BIGINT NOT NULL,
+    actor     TEXT   NOT NULL,
+    action    TEXT   NOT NULL,
+    -- The bot and room aren't foreign keys so that the log outlives them
+    bot_mxid  TEXT,
+    room_id   TEXT,
+    details   TEXT   NOT NULL DEFAULT '',
+    -- success or failure
+    result    TEXT   NOT NULL,
+    error     TEXT
+);
+
+CREATE INDEX audit_log_bot_idx ON audit_log (bot_mxid, id);
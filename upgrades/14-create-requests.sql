@@ -0,0 +1,18 @@
+-- v14: Store bot creation requests waiting for approval
+CREATE TABLE create_requests (
+-- only: postgres
+    id           BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+-- only: sqlite
+    id           INTEGER PRIMARY KEY,
+    requested_by TEXT   NOT NULL,
+    username     TEXT   NOT NULL UNIQUE,
+    -- How long the bot should live after it's created in milliseconds, or 0 if it doesn't expire
+    lifetime     BIGINT NOT NULL,
+    -- The credential flags of the create command, re-parsed when the request is approved
+    flags        TEXT   NOT NULL,
+    -- The command event, credentials are sent as a reply to it
+    room_id      TEXT   NOT NULL,
+    event_id     TEXT   NOT NULL,
+    device_id    TEXT   NOT NULL,
+    requested_at BIGINT NOT NULL
+);
@@ -0,0 +1,4 @@
+-- v15: Store the purpose of bots
+-- NULL for bots created before purposes were collected or without the policy enabled
+ALTER TABLE bots ADD COLUMN purpose TEXT;
+ALTER TABLE create_requests ADD COLUMN purpose TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- v16: Store the ID of the request that scheduled jobs
+ALTER TABLE scheduled_jobs ADD COLUMN request_id TEXT;